@@ -0,0 +1,73 @@
+// go-tucs-cache fills the offline cache of the run database with all the runs
+// and cesium scans of a period, so TUCS jobs over that period can run without
+// access to the run database (with TUCS_OFFLINE=1).
+//
+// Usage:
+//
+//	$ go-tucs-cache -begin="2012-05-01" -end="2012-06-01" -dir=$HOME/tucs-cache
+//	$ go-tucs-cache -begin="-4 weeks"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func main() {
+	var (
+		begin  = flag.String("begin", "-4 weeks", "beginning of the period (date expression)")
+		end    = flag.String("end", "now", "end of the period (date expression)")
+		dir    = flag.String("dir", "", "cache directory (default: TUCS_CACHE_DIR, or tucs/rundb under the user cache directory)")
+		driver = flag.String("driver", "", "database/sql driver of the run database (default: see tucs.DBConfig)")
+		dsn    = flag.String("dsn", "", "data source name of the run database (default: see tucs.DBConfig)")
+	)
+	flag.Parse()
+
+	now := time.Now()
+	beg, err := tucs.ParseDate(*begin, now, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fin, err := tucs.ParseDate(*end, now, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dir == "" {
+		cache, err := tucs.DBConfig{}.Resolve()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*dir = cache.Cache.Dir
+	}
+	if *dir == "" {
+		*dir, err = tucs.DefaultCacheDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// always query the run database, and refresh the cached results
+	cfg := tucs.DBConfig{
+		Driver: *driver,
+		DSN:    *dsn,
+		Cache:  tucs.CacheCfg{Dir: *dir},
+	}
+	src, err := tucs.OpenRunSource(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	csrc := src.(*tucs.CachedRunSource)
+	defer csrc.Close()
+
+	fmt.Printf("caching runs from %v to %v into %s...\n", beg, fin, csrc.Dir())
+	nruns, ncsruns, err := csrc.Prefill(beg, fin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("cached %d run(s) and %d cesium scan(s)\n", nruns, ncsruns)
+}
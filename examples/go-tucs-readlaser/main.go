@@ -16,21 +16,23 @@ func main() {
 
 	{
 		cfg := tucs.FilterCfg{
-			Runs:        []string{"-1 week"},
-			Region:      "EBC_m62_c37_highgain",
-			RunType:     "Las",
-			UseDateProg: true,
+			Runs:    tucs.RunsSince("-1 week"),
+			Region:  "EBC_m62_c37_highgain",
+			RunType: tucs.LaserRun,
 			//Verbose: false,
 			KeepOnlyActive: true,
-			//Filter: "",
+			//Filter: tucs.DefaultLaserFilter,
 			Amp: 23000.,
 			// GetLast: false,
 			UpdateSpecial: true,
 			// AllowC10Errors: false,
 			// CsComment: "",
-			// TwoInput: false,
 		}
-		app.AddWorker(tucs.NewFilter(tucs.Readout, cfg))
+		filter, err := tucs.NewFilter(tucs.Readout, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.AddWorker(filter)
 	}
 
 	{
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func main() {
+	failed := false
+	for _, useMBTS := range []bool{false, true} {
+		for _, useSpecialEBmods := range []bool{false, true} {
+			tilecal := tucs.TileCal(useMBTS, useSpecialEBmods)
+			report := tucs.ValidateTileCal(tilecal, useMBTS, useSpecialEBmods)
+			report.Print(os.Stdout)
+			if !report.OK() {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		log.Fatal("invalid TileCal mapping")
+	}
+}
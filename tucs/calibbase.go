@@ -1,9 +1,10 @@
 package tucs
 
 import (
-
+	"fmt"
 	//"os"
 	"path"
+	"reflect"
 
 	"go-hep.org/x/hep/groot"
 	"go-hep.org/x/hep/groot/rtree"
@@ -42,13 +43,13 @@ func (w *CalibBase) FileTree(file, tree string) (*groot.File, rtree.Tree) {
 		t   rtree.Tree
 	)
 
-	key := w.workdir + file
+	fname := path.Join(w.workdir, file)
+	key := fname + ":" + tree
 	c, ok := w.cache[key]
 	if ok {
 		return c.file, c.tree
 	}
 
-	fname := path.Join(w.workdir, file)
 	f, err = groot.Open(fname)
 	if err != nil {
 		return nil, nil
@@ -67,5 +68,177 @@ func (w *CalibBase) FileTree(file, tree string) (*groot.File, rtree.Tree) {
 	return f, t
 }
 
+// ReadEntry reads the branches of entry ientry of tree in file, as flat
+// slices of float64 (multi-dimensional arrays are flattened in row-major
+// order). Branches missing from the tree are missing from the returned map.
+func (w *CalibBase) ReadEntry(file, tree string, ientry int64, branches ...string) (map[string][]float64, error) {
+	var vals map[string][]float64
+	err := w.ReadEntries(file, tree, ientry, ientry+1, branches, func(_ int64, v map[string][]float64) error {
+		vals = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// ReadEntries reads the branches of the entries [beg, end) of tree in file
+// (end = -1 reads up to the last entry), and calls fct with the values of
+// each entry, as read by ReadEntry.
+func (w *CalibBase) ReadEntries(file, tree string, beg, end int64, branches []string, fct func(ientry int64, vals map[string][]float64) error) error {
+	f, t := w.FileTree(file, tree)
+	if end < 0 && t != nil {
+		end = t.Entries()
+	}
+	switch {
+	case f == nil:
+		return fmt.Errorf("tucs: could not open %q", path.Join(w.workdir, file))
+	case t == nil:
+		return fmt.Errorf("tucs: no tree %q in %q", tree, path.Join(w.workdir, file))
+	case beg < 0 || beg >= end || end > t.Entries():
+		return fmt.Errorf("tucs: no entries [%d, %d) in tree %q of %q", beg, end, tree, path.Join(w.workdir, file))
+	}
+
+	wanted := make(map[string]bool, len(branches))
+	for _, name := range branches {
+		wanted[name] = true
+	}
+	rvars := make([]rtree.ReadVar, 0, len(branches))
+	for _, rv := range rtree.NewReadVars(t) {
+		if wanted[rv.Name] {
+			rvars = append(rvars, rv)
+		}
+	}
+	if len(rvars) == 0 {
+		for i := beg; i < end; i++ {
+			err := fct(i, make(map[string][]float64))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r, err := rtree.NewReader(t, rvars, rtree.WithRange(beg, end))
+	if err != nil {
+		return fmt.Errorf("tucs: could not read %q: %w", path.Join(w.workdir, file), err)
+	}
+	defer r.Close()
+
+	err = r.Read(func(ctx rtree.RCtx) error {
+		vals := make(map[string][]float64, len(rvars))
+		for _, rv := range rvars {
+			vals[rv.Name] = flatten(reflect.ValueOf(rv.Value).Elem(), nil)
+		}
+		return fct(ctx.Entry, vals)
+	})
+	if err != nil {
+		return fmt.Errorf("tucs: could not read %q: %w", path.Join(w.workdir, file), err)
+	}
+	return nil
+}
+
+// flatten appends the numbers held by the (possibly nested) arrays or slices
+// of v to vals, in row-major order.
+func flatten(v reflect.Value, vals []float64) []float64 {
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			vals = flatten(v.Index(i), vals)
+		}
+	case reflect.Float32, reflect.Float64:
+		vals = append(vals, v.Float())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		vals = append(vals, float64(v.Int()))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		vals = append(vals, float64(v.Uint()))
+	case reflect.Bool:
+		if v.Bool() {
+			vals = append(vals, 1)
+		} else {
+			vals = append(vals, 0)
+		}
+	}
+	return vals
+}
+
+// ReadRuns reads the calibration file of each run of type rtype (AllRuns for
+// all of them) of the global RunList. fname returns the name of the file of a
+// run, relative to the working directory, and read reads it.
+// The runs without file, or whose file could not be read, are removed from
+// the global RunList. The other ones get the name of their file as
+// "filename" in their Data. name prefixes the warnings (e.g.
+// "laser.ReadLaser").
+func (w *CalibBase) ReadRuns(name string, rtype RunType, fname func(run Run) string, read func(run Run, fname string) error) {
+	for _, run := range append([]Run(nil), Runs...) {
+		if rtype != AllRuns && run.Type != string(rtype) {
+			continue
+		}
+		file := fname(run)
+		if !PathExists(path.Join(w.workdir, file)) {
+			fmt.Printf("not yet processed, removing: %v\n", run)
+			Runs.Remove(run)
+			continue
+		}
+		err := read(run, file)
+		if err != nil {
+			fmt.Printf("**warning** %s: %v, removing: %v\n", name, err, run)
+			Runs.Remove(run)
+			continue
+		}
+		run.Data["filename"] = file
+		fmt.Printf("file: %v\n", path.Join(w.workdir, file))
+	}
+}
+
+// nadcs is the number of ADCs of an ADCArray.
+const nadcs = 4 * 64 * 48 * 2
+
+// ADCArray holds a value per ADC, indexed by [ros-1][module-1][channel][gain].
+type ADCArray [4][64][48][2]float64
+
+// Set sets the values of the array from the flattened per-ADC branch vals of
+// a calibration ntuple, indexed by [ros-1][module-1][channel][gain], or by
+// [ros][module-1][channel][gain] with an unused ROS 0.
+func (a *ADCArray) Set(vals []float64) error {
+	switch len(vals) {
+	case nadcs:
+	case nadcs + nadcs/4:
+		vals = vals[nadcs/4:]
+	default:
+		return fmt.Errorf("%d values (expected %d or %d)", len(vals), nadcs, nadcs+nadcs/4)
+	}
+	i := 0
+	for ros := range a {
+		for mod := range a[ros] {
+			for ch := range a[ros][mod] {
+				for gain := range a[ros][mod][ch] {
+					a[ros][mod][ch][gain] = vals[i]
+					i++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// At returns the value of the ADC numbered nbr (see Region.Number).
+func (a *ADCArray) At(nbr []int) float64 {
+	return a[nbr[0]-1][nbr[1]-1][nbr[2]][nbr[3]]
+}
+
+// CloseFiles closes all the ROOT files opened by FileTree.
+func (w *CalibBase) CloseFiles() error {
+	var err error
+	for key, c := range w.cache {
+		if e := c.file.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(w.cache, key)
+	}
+	return err
+}
+
 // checks CalibBase implements tucs.Worker
 var _ Worker = (*CalibBase)(nil)
@@ -0,0 +1,66 @@
+package tucs
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+func TestCalibBaseReadEntry(t *testing.T) {
+	dir := t.TempDir()
+	f, err := groot.Create(filepath.Join(dir, "calib.root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, tree := range []struct {
+		name string
+		vals [2]float32
+	}{
+		{"a", [2]float32{1, 2}},
+		{"b", [2]float32{3, 4}},
+	} {
+		vals := tree.vals
+		w, err := rtree.NewWriter(f, tree.name, []rtree.WriteVar{{Name: "vals", Value: &vals}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewCalibBase(Readout, dir)
+	defer w.CloseFiles()
+	for _, table := range []struct {
+		tree string
+		want []float64
+	}{
+		{"a", []float64{1, 2}},
+		{"b", []float64{3, 4}},
+		{"a", []float64{1, 2}},
+	} {
+		vals, err := w.ReadEntry("calib.root", table.tree, 0, "vals", "missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := vals["vals"]; !reflect.DeepEqual(got, table.want) {
+			t.Fatalf("tree %q: got %v, want %v", table.tree, got, table.want)
+		}
+		if _, ok := vals["missing"]; ok {
+			t.Fatalf("tree %q: got values of a missing branch", table.tree)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package tucs
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// NumCellHashes is the number of TileCal cell hashes.
+	NumCellHashes = 5184
+
+	// NumADCHashes is the number of TileCal ADC hashes.
+	NumADCHashes = 4 * 64 * 48 * 2
+)
+
+// cell_section is a TileCal section, in the ATLAS TileID numbering.
+type cell_section int
+
+const (
+	barrel_section cell_section = iota // LBA and LBC
+	extbar_section                     // extended barrels of EBA and EBC
+	gap_section                        // ITC and gap/crack cells of EBA and EBC
+)
+
+// cell_key identifies a cell within a module.
+type cell_key struct {
+	tower  int
+	sample int // 0=A, 1=BC, 2=D, 3=E
+}
+
+var (
+	sample_names = [4]string{"sA", "sBC", "sD", "sE"}
+
+	// cell_hash_base is the first cell hash of each section, indexed by
+	// section and side (0: C side, 1: A side).
+	cell_hash_base = [3][2]int{
+		{0, 1408},    // barrel
+		{2880, 3648}, // extended barrel
+		{4416, 4800}, // gap/crack
+	}
+
+	// module_cells lists the cells of a module of each section and side, in
+	// the ATLAS TileID order: by tower, then by sample.
+	// The D0 cell only belongs to the A side.
+	module_cells = [3][2][]cell_key{
+		barrel_section: {
+			barrel_cells(false),
+			barrel_cells(true),
+		},
+		extbar_section: {
+			extbar_cells(),
+			extbar_cells(),
+		},
+		gap_section: {
+			gap_cells(),
+			gap_cells(),
+		},
+	}
+)
+
+func barrel_cells(d0 bool) []cell_key {
+	cells := make([]cell_key, 0, 23)
+	for tower := 0; tower <= 9; tower++ {
+		cells = append(cells, cell_key{tower, 0})
+		if tower <= 8 {
+			cells = append(cells, cell_key{tower, 1})
+		}
+		if (tower == 0 && d0) || tower == 2 || tower == 4 || tower == 6 {
+			cells = append(cells, cell_key{tower, 2})
+		}
+	}
+	return cells
+}
+
+func extbar_cells() []cell_key {
+	cells := make([]cell_key, 0, 12)
+	for tower := 10; tower <= 15; tower++ {
+		if tower >= 11 {
+			cells = append(cells, cell_key{tower, 0})
+		}
+		if tower <= 14 {
+			cells = append(cells, cell_key{tower, 1})
+		}
+		if tower == 10 || tower == 12 {
+			cells = append(cells, cell_key{tower, 2})
+		}
+	}
+	return cells
+}
+
+func gap_cells() []cell_key {
+	return []cell_key{
+		{8, 2},  // D4
+		{9, 1},  // C10
+		{10, 3}, // E1
+		{11, 3}, // E2
+		{13, 3}, // E3
+		{15, 3}, // E4
+	}
+}
+
+// cell_location returns the partition, module (1-64), sample and tower of the
+// cell with the given cell hash.
+func cell_location(hash int) (partition string, module int, cell cell_key, err error) {
+	if hash < 0 || hash >= NumCellHashes {
+		return "", 0, cell, fmt.Errorf("tucs: invalid cell hash %d (expected 0 to %d)", hash, NumCellHashes-1)
+	}
+	for section := len(cell_hash_base) - 1; section >= 0; section-- {
+		for side := 1; side >= 0; side-- {
+			base := cell_hash_base[section][side]
+			if hash < base {
+				continue
+			}
+			cells := module_cells[section][side]
+			idx := hash - base
+			module = idx/len(cells) + 1
+			cell = cells[idx%len(cells)]
+			partition = "LB"
+			if section != int(barrel_section) {
+				partition = "EB"
+			}
+			partition += [2]string{"C", "A"}[side]
+			return partition, module, cell, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// CellHash returns the ATLAS cell hash of a cell region of the physical tree
+// (e.g. TILECAL_LBA_m01_sA_t00).
+func (r *Region) CellHash() (int, error) {
+	if r.Type != Physical || !strings.HasPrefix(r.Name(0), "t") {
+		return -1, fmt.Errorf("tucs: %q is not a cell", r.Hash(0, 0))
+	}
+	nbr := r.Number(0, 0)
+	if len(nbr) != 4 || nbr[0] < 1 || nbr[0] > 4 {
+		return -1, fmt.Errorf("tucs: %q is not a cell", r.Hash(0, 0))
+	}
+	part, module := nbr[0], nbr[1]
+	key := cell_key{tower: nbr[3], sample: nbr[2]}
+
+	side := 1 // A side
+	if part == 2 || part == 4 {
+		side = 0 // C side
+	}
+	sections := []cell_section{barrel_section}
+	if part >= 3 {
+		sections = []cell_section{extbar_section, gap_section}
+	}
+	for _, section := range sections {
+		cells := module_cells[section][side]
+		for i, k := range cells {
+			if k == key {
+				return cell_hash_base[section][side] + (module-1)*len(cells) + i, nil
+			}
+		}
+	}
+	return -1, fmt.Errorf("tucs: %q has no cell hash", r.Hash(0, 0))
+}
+
+// CellFromHash returns the cell region of the tilecal detector tree with the
+// given ATLAS cell hash.
+func CellFromHash(tilecal *Region, hash int) (*Region, error) {
+	partition, module, cell, err := cell_location(hash)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s_m%02d_%s_t%02d", partition, module, sample_names[cell.sample], cell.tower)
+	mod := find_child(tilecal, Readout, partition, fmt.Sprintf("m%02d", module))
+	if mod != nil {
+		if smp := find_child(mod, Physical, sample_names[cell.sample]); smp != nil {
+			if c := find_child(smp, Physical, fmt.Sprintf("t%02d", cell.tower)); c != nil {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("tucs: no cell %s (cell hash %d) in detector tree", name, hash)
+}
+
+// ADCHash returns the ATLAS ADC hash of an ADC region of the readout tree
+// (e.g. TILECAL_LBA_m01_c01_highgain): (((ros-1)*64+module-1)*48+channel)*2+gain.
+func (r *Region) ADCHash() (int, error) {
+	nbr := r.Number(0, 0)
+	if r.Type != Readout || len(nbr) != 4 || nbr[0] < 1 || nbr[0] > 4 {
+		return -1, fmt.Errorf("tucs: %q is not an ADC", r.Hash(0, 0))
+	}
+	ros, module, channel, gain := nbr[0], nbr[1], nbr[2], nbr[3]
+	return (((ros-1)*64+module-1)*48+channel)*2 + gain, nil
+}
+
+// ADCFromHash returns the ADC region of the tilecal detector tree with the
+// given ATLAS ADC hash.
+func ADCFromHash(tilecal *Region, hash int) (*Region, error) {
+	if hash < 0 || hash >= NumADCHashes {
+		return nil, fmt.Errorf("tucs: invalid ADC hash %d (expected 0 to %d)", hash, NumADCHashes-1)
+	}
+	gain := [2]string{"lowgain", "highgain"}[hash%2]
+	channel := (hash / 2) % 48
+	module := (hash/(2*48))%64 + 1
+	ros := hash / (2 * 48 * 64)
+	name := fmt.Sprintf("%s_m%02d_c%02d_%s", partition_names[ros], module, channel, gain)
+	adc := find_child(tilecal, Readout,
+		partition_names[ros],
+		fmt.Sprintf("m%02d", module),
+		fmt.Sprintf("c%02d", channel),
+		gain,
+	)
+	if adc == nil {
+		return nil, fmt.Errorf("tucs: no ADC %s (ADC hash %d) in detector tree", name, hash)
+	}
+	return adc, nil
+}
+
+// find_child returns the descendant of region following the path of names
+// along the children of type rtype, or nil.
+func find_child(region *Region, rtype RegionType, names ...string) *Region {
+	for _, name := range names {
+		var next *Region
+		for _, c := range region.Children(rtype) {
+			if c.Name(0) == name {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		region = next
+	}
+	return region
+}
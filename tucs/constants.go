@@ -0,0 +1,121 @@
+package tucs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConstStore holds named calibration constants for detector regions, keyed by
+// region hash (e.g. "EBC_m62_c37_highgain", the "TILECAL_" prefix is optional).
+type ConstStore struct {
+	vals map[string]map[string]float64
+}
+
+// NewConstStore returns an empty ConstStore.
+func NewConstStore() *ConstStore {
+	return &ConstStore{vals: make(map[string]map[string]float64)}
+}
+
+// LoadConstants reads a ConstStore from the file fname (see ParseConstants).
+func LoadConstants(fname string) (*ConstStore, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not open constants file: %w", err)
+	}
+	defer f.Close()
+	s, err := ParseConstants(f)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: invalid constants file %q: %w", fname, err)
+	}
+	return s, nil
+}
+
+// ParseConstants parses constants given as one "region name value" triplet
+// per line. Everything after a '#' is a comment, blank lines are ignored:
+//
+//	# laser reference ratios of run 212000
+//	EBC_m62_c37_highgain  laser_ref      2.1
+//	EBC_m62_c37_highgain  laser_ref_err  0.02
+func ParseConstants(r io.Reader) (*ConstStore, error) {
+	s := NewConstStore()
+	scan := bufio.NewScanner(r)
+	line := 0
+	for scan.Scan() {
+		line++
+		txt := scan.Text()
+		if i := strings.Index(txt, "#"); i >= 0 {
+			txt = txt[:i]
+		}
+		fields := strings.Fields(txt)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected region, name and value, got %d field(s)", line, len(fields))
+		}
+		v, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", line, fields[2])
+		}
+		s.Set(fields[0], fields[1], v)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return s, nil
+}
+
+// const_key returns the key of region hash in a ConstStore.
+func const_key(hash string) string {
+	return strings.TrimPrefix(hash, "TILECAL_")
+}
+
+// Get returns the constant name of the region with the given hash.
+func (s *ConstStore) Get(hash, name string) (float64, bool) {
+	v, ok := s.vals[const_key(hash)][name]
+	return v, ok
+}
+
+// Set sets the constant name of the region with the given hash.
+func (s *ConstStore) Set(hash, name string, v float64) {
+	key := const_key(hash)
+	m, ok := s.vals[key]
+	if !ok {
+		m = make(map[string]float64)
+		s.vals[key] = m
+	}
+	m[name] = v
+}
+
+// Len returns the number of regions holding constants.
+func (s *ConstStore) Len() int {
+	return len(s.vals)
+}
+
+// Write writes the constants to w, in the format read by ParseConstants.
+func (s *ConstStore) Write(w io.Writer) error {
+	keys := make([]string, 0, len(s.vals))
+	for key := range s.vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		names := make([]string, 0, len(s.vals[key]))
+		for name := range s.vals[key] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, err := fmt.Fprintf(w, "%s %s %v\n", key, name, s.vals[key][name])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
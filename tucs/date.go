@@ -0,0 +1,246 @@
+package tucs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // make sure the CERN time zone is always available
+)
+
+// CERN is the local time zone of the CERN site.
+// Dates in the run databases are recorded in CERN local time.
+var CERN = load_location("Europe/Zurich")
+
+func load_location(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic("tucs: could not load time zone " + name + ": " + err.Error())
+	}
+	return loc
+}
+
+var (
+	date_abs_re  = regexp.MustCompile(`^(\d{4})[-/](\d{1,2})[-/](\d{1,2})(?:[ t]+(\d{1,2}):(\d{2})(?::(\d{2}))?)?`)
+	date_zone_re = regexp.MustCompile(`^\s*(utc|gmt|z|[+-]\d{2}:?\d{2})\b`)
+	date_rel_re  = regexp.MustCompile(`^\s*([+-]?)\s*(\d*)\s*([a-z]+)`)
+)
+
+// offset is a relative date offset.
+type offset struct {
+	years, months, days int
+	dur                 time.Duration
+}
+
+// add returns the offset o + k*rhs.
+func (o offset) add(rhs offset, k int) offset {
+	return offset{
+		years:  o.years + k*rhs.years,
+		months: o.months + k*rhs.months,
+		days:   o.days + k*rhs.days,
+		dur:    o.dur + time.Duration(k)*rhs.dur,
+	}
+}
+
+// rel_units are the units of relative offsets, without plural 's', with the
+// offset of one unit.
+var rel_units = map[string]offset{
+	"sec":       {dur: time.Second},
+	"second":    {dur: time.Second},
+	"min":       {dur: time.Minute},
+	"minute":    {dur: time.Minute},
+	"hour":      {dur: time.Hour},
+	"day":       {days: 1},
+	"week":      {days: 7},
+	"fortnight": {days: 14},
+	"month":     {months: 1},
+	"year":      {years: 1},
+}
+
+// max_rel is the largest number of units of a relative offset: it keeps the
+// offsets within the range of time.Duration (about 292 years of seconds).
+const max_rel = 1 << 33
+
+// ParseDate interprets a date expression, as the Python TUCS did when handing
+// it over to GNU 'date -d'.
+//
+// The supported expressions are:
+//   - absolute dates: "2012-05-01", "2012/05/01", "2012-05-01 14:30" or
+//     "2012-05-01 14:30:00", optionally followed by a "UTC" or "Z" time zone,
+//     or by a "+hh:mm" one after a time of day,
+//   - the keywords "now", "today", "yesterday" and "tomorrow",
+//   - relative offsets: "-1 week", "+3 days", "2 weeks ago", "last month",
+//     "next week", with units of seconds, minutes, hours, days, weeks,
+//     fortnights, months and years ("ago" reverses the offset before it
+//     only, e.g. "-1 week 2 days ago" is 9 days before),
+//   - an absolute date or a keyword followed by relative offsets, e.g.
+//     "2012-05-01 -28 days" or "2012-05-01-28 days".
+//
+// Relative offsets are applied to the absolute date, if any, or to now.
+// Dates without explicit time zone are interpreted in loc (CERN local time if
+// loc is nil), and so are calendar offsets (days, weeks, ...).
+func ParseDate(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = CERN
+	}
+	bad := func(format string, args ...interface{}) (time.Time, error) {
+		return time.Time{}, fmt.Errorf("tucs: invalid date expression %q: %s",
+			expr, fmt.Sprintf(format, args...))
+	}
+
+	s := strings.ToLower(strings.TrimSpace(expr))
+	if s == "" {
+		return bad("empty expression")
+	}
+
+	var (
+		off   offset
+		last  offset // last relative offset, reversed by "ago"
+		ago   bool   // whether "ago" may follow
+		first = true // whether a keyword is allowed
+	)
+
+	date := now.In(loc)
+	if m := date_abs_re.FindStringSubmatch(s); m != nil {
+		var nums [6]int // year, month, day, hour, min, sec
+		for i, v := range m[1:7] {
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return bad("invalid number %q", v)
+			}
+			nums[i] = n
+		}
+		year, month, day := nums[0], nums[1], nums[2]
+		hour, min, sec := nums[3], nums[4], nums[5]
+		if month < 1 || month > 12 || day < 1 || day > 31 ||
+			hour > 23 || min > 59 || sec > 60 {
+			return bad("date out of range")
+		}
+		s = s[len(m[0]):]
+
+		// numeric zones need a time of day, as they would be ambiguous
+		// with relative offsets otherwise (e.g. "2012-05-01 -1000 seconds")
+		zone := loc
+		z := date_zone_re.FindStringSubmatch(s)
+		if z != nil && (m[4] != "" || !strings.ContainsAny(z[1][:1], "+-")) {
+			var err error
+			zone, err = parse_zone(z[1])
+			if err != nil {
+				return bad("%v", err)
+			}
+			s = s[len(z[0]):]
+		}
+		date = time.Date(year, time.Month(month), day, hour, min, sec, 0, zone)
+		if date.Day() != day {
+			return bad("no day %d in %s %d", day, time.Month(month), year)
+		}
+		date = date.In(loc)
+		first = false
+	}
+
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+		m := date_rel_re.FindStringSubmatch(s)
+		if m == nil {
+			return bad("unexpected %q", s)
+		}
+		s = s[len(m[0]):]
+
+		sign, num, word := m[1], m[2], m[3]
+		n := 1
+		if num != "" {
+			var err error
+			n, err = strconv.Atoi(num)
+			if err != nil || n > max_rel {
+				return bad("offset %q out of range", num)
+			}
+		}
+		if sign == "-" {
+			n = -n
+		}
+
+		if sign == "" && num == "" {
+			switch word {
+			case "now", "today":
+				if !first {
+					return bad("unexpected %q", word)
+				}
+				first = false
+				continue
+			case "yesterday":
+				if !first {
+					return bad("unexpected %q", word)
+				}
+				first = false
+				off.days--
+				continue
+			case "tomorrow":
+				if !first {
+					return bad("unexpected %q", word)
+				}
+				first = false
+				off.days++
+				continue
+			case "ago":
+				if !ago {
+					return bad("'ago' without offset")
+				}
+				off = off.add(last, -2)
+				ago = false
+				continue
+			case "last", "next":
+				u := date_rel_re.FindStringSubmatch(s)
+				if u == nil || u[1] != "" || u[2] != "" {
+					return bad("%q without unit", word)
+				}
+				s = s[len(u[0]):]
+				n = 1
+				if word == "last" {
+					n = -1
+				}
+				word = u[3]
+			}
+		}
+		first = false
+
+		unit, ok := rel_units[strings.TrimSuffix(word, "s")]
+		if !ok {
+			return bad("unknown unit %q", word)
+		}
+		last = offset{}.add(unit, n)
+		off = off.add(last, 1)
+		ago = true
+	}
+
+	date = date.AddDate(off.years, off.months, off.days).Add(off.dur)
+	return date, nil
+}
+
+// parse_zone converts a time zone designator matched by date_zone_re.
+func parse_zone(z string) (*time.Location, error) {
+	switch z {
+	case "utc", "gmt", "z":
+		return time.UTC, nil
+	}
+	sign := 1
+	if z[0] == '-' {
+		sign = -1
+	}
+	hhmm := strings.Replace(z[1:], ":", "", 1)
+	hh, err := strconv.Atoi(hhmm[:2])
+	if err != nil || hh > 14 {
+		return nil, fmt.Errorf("invalid time zone %q", z)
+	}
+	mm, err := strconv.Atoi(hhmm[2:])
+	if err != nil || mm > 59 {
+		return nil, fmt.Errorf("invalid time zone %q", z)
+	}
+	return time.FixedZone(strings.ToUpper(z), sign*(hh*3600+mm*60)), nil
+}
@@ -0,0 +1,124 @@
+package tucs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2012, time.May, 15, 12, 0, 0, 0, CERN)
+	cern := func(y int, m time.Month, d, hh, mm, ss int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, CERN)
+	}
+	day := 24 * time.Hour
+
+	for _, table := range []struct {
+		expr string
+		want time.Time
+	}{
+		// absolute dates
+		{"2012-05-01", cern(2012, time.May, 1, 0, 0, 0)},
+		{"2012/5/1", cern(2012, time.May, 1, 0, 0, 0)},
+		{"2012-05-01 14:30", cern(2012, time.May, 1, 14, 30, 0)},
+		{"2012-05-01T14:30:15", cern(2012, time.May, 1, 14, 30, 15)},
+		{"2012-02-29", cern(2012, time.February, 29, 0, 0, 0)},
+
+		// time zones
+		{"2012-05-01 14:30 UTC", time.Date(2012, time.May, 1, 14, 30, 0, 0, time.UTC)},
+		{"2012-05-01 14:30Z", time.Date(2012, time.May, 1, 14, 30, 0, 0, time.UTC)},
+		{"2012-05-01 14:30 +02:00", time.Date(2012, time.May, 1, 12, 30, 0, 0, time.UTC)},
+		{"2012-05-01 14:30 -0130", time.Date(2012, time.May, 1, 16, 0, 0, 0, time.UTC)},
+		{"2012-05-01 gmt", time.Date(2012, time.May, 1, 0, 0, 0, 0, time.UTC)},
+
+		// keywords
+		{"now", now},
+		{"today", now},
+		{"yesterday", now.Add(-day)},
+		{"tomorrow", now.Add(day)},
+
+		// relative dates
+		{"-1 week", now.Add(-7 * day)},
+		{"+3 days", now.Add(3 * day)},
+		{"-90 minutes", now.Add(-90 * time.Minute)},
+		{"1 hour 30 min", now.Add(90 * time.Minute)},
+		{"3 fortnights", now.Add(42 * day)},
+		{"-1 month", cern(2012, time.April, 15, 12, 0, 0)},
+		{"2012-05-01 -28 days", cern(2012, time.April, 3, 0, 0, 0)},
+		{"2012-05-01-28 days", cern(2012, time.April, 3, 0, 0, 0)},
+		{"2012-05-01 -1000 seconds", cern(2012, time.April, 30, 23, 43, 20)},
+		{"yesterday -2 hours", now.Add(-26 * time.Hour)},
+
+		// ago
+		{"2 weeks ago", now.Add(-14 * day)},
+		{"-1 week ago", now.Add(7 * day)},
+		{"-1 week 2 days ago", now.Add(-9 * day)},
+		{"1 day 2 hours ago", now.Add(22 * time.Hour)},
+		{"2012-05-01 1 year ago", cern(2011, time.May, 1, 0, 0, 0)},
+
+		// last and next
+		{"last month", cern(2012, time.April, 15, 12, 0, 0)},
+		{"next week", now.Add(7 * day)},
+		{"last year 2 days", cern(2011, time.May, 17, 12, 0, 0)},
+	} {
+		t.Run(table.expr, func(t *testing.T) {
+			got, err := ParseDate(table.expr, now, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(table.want) {
+				t.Fatalf("got %v, want %v", got, table.want)
+			}
+		})
+	}
+}
+
+func TestParseDateLocation(t *testing.T) {
+	now := time.Date(2012, time.May, 15, 12, 0, 0, 0, time.UTC)
+	got, err := ParseDate("2012-05-01 14:30", now, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2012, time.May, 1, 14, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// calendar offsets are applied in the location: one day over a DST change
+	// is 23 hours long.
+	now = time.Date(2012, time.March, 25, 12, 0, 0, 0, CERN)
+	got, err = ParseDate("yesterday", now, CERN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-23 * time.Hour); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	now := time.Date(2012, time.May, 15, 12, 0, 0, 0, CERN)
+	for _, expr := range []string{
+		"",
+		"2012-13-01",
+		"2012-02-30",
+		"2012-05-01 25:00",
+		"2012-05-01 14:30 +25:00",
+		"2012-05-01 14:30 +02:75",
+		"ago",
+		"1 day ago ago",
+		"last",
+		"next 2 weeks",
+		"5 parsecs",
+		"today yesterday",
+		"2012-05-01 now",
+		"99999999999999999999 days",
+		"9999999999 seconds",
+		"2012-05-01 junk!",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			got, err := ParseDate(expr, now, nil)
+			if err == nil {
+				t.Fatalf("expected an error, got %v", got)
+			}
+		})
+	}
+}
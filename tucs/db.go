@@ -0,0 +1,278 @@
+package tucs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const (
+	// DefaultDBDriver is the database/sql driver used to connect to the
+	// ATLAS run database.
+	DefaultDBDriver = "mysql"
+
+	// DefaultDBDSN is the data source name of the ATLAS run database.
+	DefaultDBDSN = "reader@tcp(pcata007.cern.ch:3306)/tile?parseTime=true&loc=Europe%2FZurich"
+)
+
+// DBConfig describes the connection to a run database.
+type DBConfig struct {
+	Driver string   `json:"driver"` // name of the database/sql driver (only "mysql" is supported)
+	DSN    string   `json:"dsn"`    // data source name
+	Cache  CacheCfg `json:"cache"`  // offline cache of the query results, if enabled
+}
+
+// LoadDBConfig reads a DBConfig from a JSON file:
+//
+//	{
+//	  "driver": "mysql",
+//	  "dsn": "reader@tcp(localhost:3306)/tile?parseTime=true",
+//	  "cache": {"dir": "/data/tucs-cache", "expiry": "24h"}
+//	}
+func LoadDBConfig(fname string) (DBConfig, error) {
+	var cfg DBConfig
+	f, err := os.Open(fname)
+	if err != nil {
+		return cfg, fmt.Errorf("tucs: could not open database configuration: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("tucs: could not read database configuration %q: %w", fname, err)
+	}
+	return cfg, nil
+}
+
+// IsZero returns whether no connection setting was provided.
+func (cfg DBConfig) IsZero() bool {
+	return cfg.Driver == "" && cfg.DSN == ""
+}
+
+// Resolve returns the connection settings to use for cfg, taken from the
+// first of:
+//   - cfg itself, if not zero,
+//   - the TUCS_DB_DRIVER and TUCS_DB_DSN environment variables,
+//   - the JSON file named by the TUCS_DB_CONFIG environment variable, or
+//     tucs/db.json under the user configuration directory,
+//   - DefaultDBDriver and DefaultDBDSN.
+//
+// A missing driver defaults to DefaultDBDriver.
+// The cache settings, if not provided, are taken from the TUCS_CACHE_DIR,
+// TUCS_CACHE_EXPIRY and TUCS_OFFLINE environment variables.
+// Resolve fails if the driver is not registered with database/sql.
+func (cfg DBConfig) Resolve() (DBConfig, error) {
+	var err error
+	cache := cfg.Cache
+	switch {
+	case !cfg.IsZero():
+		// explicit configuration
+	case os.Getenv("TUCS_DB_DRIVER") != "" || os.Getenv("TUCS_DB_DSN") != "":
+		cfg.Driver = os.Getenv("TUCS_DB_DRIVER")
+		cfg.DSN = os.Getenv("TUCS_DB_DSN")
+	default:
+		fname := os.Getenv("TUCS_DB_CONFIG")
+		if fname == "" {
+			if dir, err := os.UserConfigDir(); err == nil {
+				if name := filepath.Join(dir, "tucs", "db.json"); PathExists(name) {
+					fname = name
+				}
+			}
+		}
+		if fname != "" {
+			cfg, err = LoadDBConfig(fname)
+			if err != nil {
+				return cfg, err
+			}
+		} else {
+			cfg = DBConfig{Driver: DefaultDBDriver, DSN: DefaultDBDSN}
+		}
+	}
+
+	if cfg.Driver == "" {
+		cfg.Driver = DefaultDBDriver
+	}
+	if cache != (CacheCfg{}) {
+		cfg.Cache = cache
+	}
+	if cfg.Cache == (CacheCfg{}) {
+		cfg.Cache, err = cache_from_env()
+		if err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.DSN == "" {
+		return cfg, fmt.Errorf("tucs: no data source name for database driver %q", cfg.Driver)
+	}
+
+	drivers := sql.Drivers()
+	idx := sort.SearchStrings(drivers, cfg.Driver)
+	if idx == len(drivers) || drivers[idx] != cfg.Driver {
+		return cfg, fmt.Errorf(
+			"tucs: database driver %q is not registered (missing import of its package?), registered drivers: [%s]",
+			cfg.Driver, strings.Join(drivers, ", "),
+		)
+	}
+
+	if _, err := sql_dialect_for(cfg.Driver); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// OpenRunSource returns a RunSource querying the run database described by
+// cfg (see DBConfig.Resolve), through its cache if enabled.
+// The connection pool is owned by the returned RunSource.
+func OpenRunSource(cfg DBConfig) (RunSource, error) {
+	cfg, err := cfg.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	return open_db_source(cfg)
+}
+
+// open_db_source opens a new connection pool to the database described by the
+// resolved cfg, owned by the returned RunSource.
+func open_db_source(cfg DBConfig) (RunSource, error) {
+	if cfg.Cache.Offline {
+		return NewCachedRunSource(nil, cfg.Cache)
+	}
+	dialect, err := sql_dialect_for(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not open run database: %w", err)
+	}
+	return with_cache(&sqlRunSource{db: db, dialect: dialect}, cfg.Cache)
+}
+
+// with_cache wraps src into a CachedRunSource if the cache is enabled.
+func with_cache(src RunSource, cache CacheCfg) (RunSource, error) {
+	if !cache.Enabled() {
+		return src, nil
+	}
+	csrc, err := NewCachedRunSource(src, cache)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return csrc, nil
+}
+
+// sourceHolder holds the RunSource of a worker: either the one provided by its
+// configuration, or one connected to the run database described by dbcfg.
+// It is meant to be embedded in workers.
+type sourceHolder struct {
+	src    RunSource // source of run metadata
+	own    bool      // whether src was opened by (and should be closed by) the worker
+	shared bool      // whether src was provided by an App (its connection pool is closed by the App)
+	dbcfg  DBConfig  // run database settings, when no RunSource was provided
+}
+
+// init_source sets up the holder from the configuration of a worker.
+func (h *sourceHolder) init_source(src RunSource, cfg DBConfig) error {
+	var err error
+	h.src = src
+	if src == nil {
+		h.dbcfg, err = cfg.Resolve()
+	}
+	return err
+}
+
+// setup connects the worker to the run database through the connection pool
+// of the App, if no RunSource was provided.
+// The RunSource of a previous App.Run is replaced, as its connection pool was
+// closed at the end of that run.
+func (h *sourceHolder) setup(app *App) error {
+	if h.src != nil && !h.shared {
+		return nil
+	}
+	src, err := app.RunSource(h.dbcfg)
+	if err != nil {
+		return err
+	}
+	h.src = src
+	h.shared = true
+	return nil
+}
+
+// open_source connects the worker to the run database, if it was not run by
+// an App.
+func (h *sourceHolder) open_source() error {
+	if h.src != nil {
+		return nil
+	}
+	src, err := open_db_source(h.dbcfg)
+	if err != nil {
+		return err
+	}
+	h.src = src
+	h.own = true
+	return nil
+}
+
+// close_source closes the RunSource if it was opened by the worker, or
+// provided by an App (which leaves the connection pool open until the end of
+// App.Run).
+func (h *sourceHolder) close_source() error {
+	if !h.own && !h.shared {
+		return nil
+	}
+	err := h.src.Close()
+	h.src = nil
+	h.own = false
+	h.shared = false
+	return err
+}
+
+// RunSource returns a RunSource querying the run database described by cfg
+// (see DBConfig.Resolve).
+// All the RunSources the App returns for the same settings share the same
+// connection pool, which is owned by the App and closed at the end of Run.
+// Closing these RunSources is a no-op.
+func (app *App) RunSource(cfg DBConfig) (RunSource, error) {
+	cfg, err := cfg.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Cache.Offline {
+		return NewCachedRunSource(nil, cfg.Cache)
+	}
+	dialect, err := sql_dialect_for(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	key := DBConfig{Driver: cfg.Driver, DSN: cfg.DSN}
+	db, ok := app.dbs[key]
+	if !ok {
+		db, err = sql.Open(cfg.Driver, cfg.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not open run database: %w", err)
+		}
+		app.dbs[key] = db
+	}
+	return with_cache(&sqlRunSource{db: db, dialect: dialect, shared: true}, cfg.Cache)
+}
+
+// close_dbs closes the connection pools owned by the App.
+func (app *App) close_dbs() error {
+	var err error
+	for cfg, db := range app.dbs {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(app.dbs, cfg)
+	}
+	return err
+}
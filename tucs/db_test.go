@@ -0,0 +1,66 @@
+package tucs
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSourceHolderSetup(t *testing.T) {
+	for _, env := range []string{"TUCS_CACHE_DIR", "TUCS_CACHE_EXPIRY", "TUCS_OFFLINE"} {
+		t.Setenv(env, "")
+	}
+
+	for _, stop := range []bool{true, false} {
+		app := &App{dbs: make(map[DBConfig]*sql.DB)}
+		var h sourceHolder
+		err := h.init_source(nil, DBConfig{Driver: "mysql", DSN: "reader@tcp(localhost:1)/tile"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 2 App.Run, with or without ProcessStop
+		var dbs []*sql.DB
+		for i := 0; i < 2; i++ {
+			err = h.setup(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dbs = append(dbs, h.src.(*sqlRunSource).db)
+			if stop {
+				err = h.close_source()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if h.src != nil {
+					t.Fatalf("stop=%v: RunSource of the App kept after close_source", stop)
+				}
+			}
+			err = app.close_dbs()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if dbs[0] == dbs[1] {
+			t.Fatalf("stop=%v: closed connection pool reused by the second run", stop)
+		}
+	}
+
+	// RunSources of the configuration are kept
+	src := NewMemRunSource(nil, nil)
+	var h sourceHolder
+	err := h.init_source(src, DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.setup(&App{dbs: make(map[DBConfig]*sql.DB)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.close_source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.src != src {
+		t.Fatalf("RunSource of the configuration replaced")
+	}
+}
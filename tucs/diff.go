@@ -0,0 +1,177 @@
+package tucs
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValueDiff describes a data value which differs between two events of the
+// same run.
+type ValueDiff struct {
+	Run Run
+	Key string
+	Old interface{} // nil if the key is missing from the old event
+	New interface{} // nil if the key is missing from the new event
+}
+
+func (d ValueDiff) String() string {
+	return fmt.Sprintf("run %d [%s] %s: %v -> %v", d.Run.Number, d.Run.Type, d.Key, d.Old, d.New)
+}
+
+// RegionDiff holds the differences between the events a region carries in two
+// detector trees.
+type RegionDiff struct {
+	Hash    string      // hash of the region in the new tree (in the old tree if it is missing from the new one)
+	Added   []Event     // events only present in the new tree
+	Removed []Event     // events only present in the old tree
+	Changed []ValueDiff // values which changed beyond the tolerance
+}
+
+// Empty returns whether the region carries the same events in both trees.
+func (d *RegionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares, region by region, the events held by the detector trees old
+// and cur and returns the differences for each region whose events differ.
+//
+// Regions are matched by their hash relative to the root of their tree (old
+// or cur), so that a subtree may be compared with its Clone, and events by
+// run type and run number.
+// Numerical values are considered equal when they differ by no more than tol,
+// other values are compared for deep equality.
+func Diff(old, cur *Region, rtype RegionType, tol float64) []RegionDiff {
+	keys := make([]string, 0)
+	olds := make(map[string]*Region)
+	curs := make(map[string]*Region)
+
+	collect := func(root *Region, regions map[string]*Region) RegionFct {
+		prefix := root.Hash(0, 0)
+		return func(t RegionType, region *Region) error {
+			key := strings.TrimPrefix(region.Hash(0, 0), prefix)
+			if _, ok := regions[key]; ok {
+				return nil
+			}
+			if _, ok := olds[key]; !ok {
+				if _, ok := curs[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			regions[key] = region
+			return nil
+		}
+	}
+	old.IterRegions(rtype, collect(old, olds))
+	cur.IterRegions(rtype, collect(cur, curs))
+
+	diffs := make([]RegionDiff, 0)
+	for _, key := range keys {
+		var oevts, cevts []Event
+		o, ook := olds[key]
+		if ook {
+			oevts = o.Events()
+		}
+		c, cok := curs[key]
+		if cok {
+			cevts = c.Events()
+		}
+		d := diff_events(oevts, cevts, tol)
+		if d.Empty() {
+			continue
+		}
+		if cok {
+			d.Hash = c.Hash(0, 0)
+		} else {
+			d.Hash = o.Hash(0, 0)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+func diff_events(olds, curs []Event, tol float64) RegionDiff {
+	type key struct {
+		rtype string
+		run   int64
+	}
+
+	var d RegionDiff
+
+	// events of the same run are paired in order of appearance
+	idx := make(map[key][]int)
+	for i, evt := range curs {
+		k := key{evt.Run.Type, evt.Run.Number}
+		idx[k] = append(idx[k], i)
+	}
+
+	used := make([]bool, len(curs))
+	for _, oevt := range olds {
+		k := key{oevt.Run.Type, oevt.Run.Number}
+		ids := idx[k]
+		if len(ids) == 0 {
+			d.Removed = append(d.Removed, oevt)
+			continue
+		}
+		i := ids[0]
+		idx[k] = ids[1:]
+		used[i] = true
+		d.Changed = append(d.Changed, diff_data(oevt, curs[i], tol)...)
+	}
+
+	for i, evt := range curs {
+		if !used[i] {
+			d.Added = append(d.Added, evt)
+		}
+	}
+	return d
+}
+
+func diff_data(old, cur Event, tol float64) []ValueDiff {
+	diffs := make([]ValueDiff, 0)
+	for k, ov := range old.Data {
+		cv, ok := cur.Data[k]
+		if !ok {
+			diffs = append(diffs, ValueDiff{Run: cur.Run, Key: k, Old: ov})
+			continue
+		}
+		if !equal_value(ov, cv, tol) {
+			diffs = append(diffs, ValueDiff{Run: cur.Run, Key: k, Old: ov, New: cv})
+		}
+	}
+	for k, cv := range cur.Data {
+		if _, ok := old.Data[k]; !ok {
+			diffs = append(diffs, ValueDiff{Run: cur.Run, Key: k, New: cv})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs
+}
+
+func equal_value(a, b interface{}, tol float64) bool {
+	fa, oka := to_float(a)
+	fb, okb := to_float(b)
+	if oka && okb {
+		if math.IsNaN(fa) || math.IsNaN(fb) {
+			return math.IsNaN(fa) && math.IsNaN(fb)
+		}
+		return math.Abs(fa-fb) <= tol
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// to_float converts any numerical value to a float64
+func to_float(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
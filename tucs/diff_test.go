@@ -0,0 +1,137 @@
+package tucs
+
+import (
+	"testing"
+	"time"
+)
+
+// adcs returns the ADC regions of the tree rooted at root
+func adcs(root *Region) []*Region {
+	var regions []*Region
+	root.IterRegions(Readout, func(t RegionType, region *Region) error {
+		if len(region.Number(0, 0)) == 4 {
+			regions = append(regions, region)
+		}
+		return nil
+	})
+	return regions
+}
+
+func TestRegionClone(t *testing.T) {
+	tilecal := TileCal(false, false)
+	run := mkrun(212000, "Las", utc(2012, time.May, 1, 12, 0))
+	run.Data["info"] = DataMap{"comment": "ok"}
+	regions := adcs(tilecal)
+	for i, region := range regions[:10] {
+		region.AddEvent(Event{Run: run, Data: DataMap{"signal": float64(i), "hits": []int{i}}})
+	}
+
+	clone := tilecal.Clone()
+	cregions := adcs(clone)
+	if len(cregions) != len(regions) {
+		t.Fatalf("got %d ADCs, want %d", len(cregions), len(regions))
+	}
+	for i, region := range regions {
+		if got, want := cregions[i].Hash(0, 0), region.Hash(0, 0); got != want {
+			t.Fatalf("ADC %d: got hash %q, want %q", i, got, want)
+		}
+		if cregions[i] == region {
+			t.Fatalf("ADC %d: region shared with the original tree", i)
+		}
+	}
+
+	evts := cregions[0].Events()
+	evts[0].Data["hits"].([]int)[0] = 42
+	evts[0].Run.Data["extra"] = true
+	if got := regions[0].Events()[0].Data["hits"].([]int)[0]; got != 0 {
+		t.Fatalf("event data shared with the clone: hits[0]=%d", got)
+	}
+	if _, ok := run.Data["extra"]; ok {
+		t.Fatalf("run data shared with the clone")
+	}
+	if _, ok := cregions[1].Events()[0].Run.Data["extra"]; !ok {
+		t.Fatalf("run data of the clone not shared between its events")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t0 := utc(2012, time.May, 1, 12, 0)
+	tilecal := TileCal(false, false)
+	regions := adcs(tilecal)
+	for i, region := range regions[:4] {
+		region.AddEvent(Event{Run: mkrun(212000, "Las", t0), Data: DataMap{"signal": float64(i)}})
+	}
+
+	for _, table := range []struct {
+		name string
+		old  *Region
+		cur  func(old *Region) *Region
+		tol  float64
+		want map[string][3]int // number of added, removed and changed values per hash
+	}{
+		{
+			name: "same",
+			old:  tilecal,
+			cur:  func(old *Region) *Region { return old.Clone() },
+			want: map[string][3]int{},
+		},
+		{
+			name: "subtree",
+			old:  regions[0].Parent(Readout, 0).Parent(Readout, 0),
+			cur:  func(old *Region) *Region { return old.Clone() },
+			want: map[string][3]int{},
+		},
+		{
+			name: "changed",
+			old:  tilecal,
+			cur: func(old *Region) *Region {
+				cur := old.Clone()
+				adcs(cur)[1].Events()[0].Data["signal"] = 1.5
+				return cur
+			},
+			want: map[string][3]int{regions[1].Hash(0, 0): {0, 0, 1}},
+		},
+		{
+			name: "within-tolerance",
+			old:  tilecal,
+			cur: func(old *Region) *Region {
+				cur := old.Clone()
+				adcs(cur)[1].Events()[0].Data["signal"] = 1.05
+				return cur
+			},
+			tol:  0.1,
+			want: map[string][3]int{},
+		},
+		{
+			name: "added-removed",
+			old:  tilecal,
+			cur: func(old *Region) *Region {
+				cur := old.Clone()
+				cregions := adcs(cur)
+				cregions[2].SetEvents(nil)
+				cregions[5].AddEvent(Event{Run: mkrun(212001, "Las", t0), Data: DataMap{}})
+				return cur
+			},
+			want: map[string][3]int{
+				regions[2].Hash(0, 0): {0, 1, 0},
+				regions[5].Hash(0, 0): {1, 0, 0},
+			},
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			diffs := Diff(table.old, table.cur(table.old), Readout, table.tol)
+			got := make(map[string][3]int, len(diffs))
+			for _, d := range diffs {
+				got[d.Hash] = [3]int{len(d.Added), len(d.Removed), len(d.Changed)}
+			}
+			if len(got) != len(table.want) {
+				t.Fatalf("got %d differing regions %v, want %v", len(got), got, table.want)
+			}
+			for hash, want := range table.want {
+				if got[hash] != want {
+					t.Fatalf("%s: got %v, want %v", hash, got[hash], want)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,47 @@ import (
 
 type DataMap map[string]interface{}
 
+// Clone returns a deep copy of this DataMap.
+// Nested maps and slices of basic types are copied, other values are shared.
+func (dm DataMap) Clone() DataMap {
+	if dm == nil {
+		return nil
+	}
+	o := make(DataMap, len(dm))
+	for k, v := range dm {
+		o[k] = clone_value(v)
+	}
+	return o
+}
+
+func clone_value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case DataMap:
+		return v.Clone()
+	case map[string]interface{}:
+		return map[string]interface{}(DataMap(v).Clone())
+	case []interface{}:
+		o := make([]interface{}, len(v))
+		for i, vv := range v {
+			o[i] = clone_value(vv)
+		}
+		return o
+	case []float64:
+		return append([]float64(nil), v...)
+	case []float32:
+		return append([]float32(nil), v...)
+	case []int:
+		return append([]int(nil), v...)
+	case []int64:
+		return append([]int64(nil), v...)
+	case []string:
+		return append([]string(nil), v...)
+	case []bool:
+		return append([]bool(nil), v...)
+	}
+	return v
+}
+
 type Event struct {
 	Run  Run
 	Data DataMap
@@ -1,117 +1,207 @@
 package tucs
 
 import (
-	"database/sql"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 // filterWorker selects runs for TUCS to use.
 type filterWorker struct {
 	Base
-	region           []string         // region selection
-	runs             []Run            // run list
-	runlst           []Run            // run list
-	cs_atlas_runlst  []int64          // run-nbr set
-	run_type         string           // requested run-type
-	flags            map[int64]string // digiflags for each run-number
-	keep_only_active bool             // only keep the active detector parts
-	verbose          bool             // enable verbose output
-	update_special   bool             // specified update
-	allow_c10_err    bool             // allow errors for C10
-	cs_comment       string           // cesium run/magnet description
-	two_inputs       bool             // whether CIS runs should be between 2 dates
-	filter           string           // store which laser filter is requested
-	amp              float64          // requested amperage
-
-	db     *sql.DB
-	a_bad  []int         // list of special PMTs with cut-outs for A16
-	ma_bad []int         // list of special modules with cut-outs for A16
-	c_bad  []int         // list of special PMTs for C10
-	d_bad  []int         // list of special PMTs for D5
-	md_bad []int         // list of special modules EBA15 and EBC18
-	period time.Duration // period of time used for cesium runs
+	sourceHolder
+	region           []string             // region selection
+	names            []string             // region selection by name
+	cells            map[int]bool         // region selection by cell hash
+	adcs             map[int]bool         // region selection by ADC hash
+	runs             []Run                // run list
+	runlst           []Run                // run list
+	cs_atlas_runlst  []int64              // run-nbr set
+	run_type         RunType              // requested run-type
+	status           map[int64]*RunStatus // drawers in readout for each run-number
+	quality          []RunQualitySource   // run quality registries
+	run_entries      []RunEntry           // entries of the run file, if any
+	keep_only_active bool                 // only keep the active detector parts
+	verbose          bool                 // enable verbose output
+	update_special   bool                 // specified update
+	allow_c10_err    bool                 // allow errors for C10
+	cs_comment       string               // cesium run/magnet description
+	filter           LaserFilter          // requested laser filter
+	amp              float64              // requested amperage
+
+	loc     *time.Location     // time zone of date expressions
+	cfg     FilterCfg          // configuration for the run selection
+	a_bad   []int              // list of special PMTs with cut-outs for A16
+	ma_bad  []int              // list of special modules with cut-outs for A16
+	c_bad   []int              // list of special PMTs for C10
+	d_bad   []int              // list of special PMTs for D5
+	md_bad  []int              // list of special modules EBA15 and EBC18
+	period  time.Duration      // period of time used for cesium runs
+	cs_refs []Run              // reference runs of the cesium selection
+	cs_runs map[string][]CsRun // cesium scans of each module (e.g. "LBA_m01"), ordered by time
+	cs_data map[int64]DataMap  // Run.Data shared by the events of each cesium scan
 }
 
 // FilterCfg is a helper struct to ease the configuration of NewFilter
 type FilterCfg struct {
-	Runs           interface{} //[]string
+	Runs           RunSpec // requested runs (see SingleRun, RunNumbers, RunFile, RunsSince and RunsBetween)
 	RunSet         string
-	Region         string // fixme: use a const-type
-	UseDateProg    bool
+	Region         string // comma-separated region names (e.g. "LBA_m01"), cell hashes ("H123") or ADC hashes ("ADC456")
 	Verbose        bool
-	RunType        string  // fixme: use a const-type
-	KeepOnlyActive bool    // only keep the active detector parts
-	Filter         string  // requested laser filter. fixme: type-safety
-	Amp            float64 // requested amperage
+	RunType        RunType     // requested run type
+	KeepOnlyActive bool        // only keep the active detector parts
+	Filter         LaserFilter // requested laser filter
+	Amp            float64     // requested amperage
 	GetLast        bool
 	UpdateSpecial  bool
-	AllowC10Errors bool   // allow errors for C10
-	CsComment      string // cesium run/magnet description. fixme: type-safety
-	TwoInput       bool   // whether CIS runs should be between 2 dates
+	AllowC10Errors bool           // allow errors for C10
+	CsComment      string         // cesium run/magnet description. fixme: type-safety
+	Source         RunSource      // source of run metadata (default: the run database described by DB)
+	DB             DBConfig       // run database settings (default: see DBConfig.Resolve)
+	Location       *time.Location // time zone of date expressions (default: CERN local time)
+
+	// Run quality registries: runs excluded for the whole detector are
+	// dropped (see DroppedRuns), runs excluded for some partitions only
+	// lose the events of those partitions. The run source is also used
+	// when it implements RunQualitySource. For cesium runs, the entries
+	// concern the cesium scan numbers.
+	Quality     RunQualitySource // run quality registry (e.g. NewRunQuality)
+	QualityFile string           // run quality registry file (see LoadRunQuality)
 }
 
-// NewFilter creates a new filterWorker
-func NewFilter(rtype RegionType, cfg FilterCfg) Worker {
-	run, run2, two_inputs := translate_runs(&cfg)
+// NewFilter creates a new filterWorker.
+// The whole configuration is validated up front and all the problems found are
+// reported in the returned error.
+// The selected runs known to the run database carry their RunInfo in Run.Data
+// (see Run.Info), and the runs listed in a run quality registry their BadRun
+// entries (see Run.Quality).
+func NewFilter(rtype RegionType, cfg FilterCfg) (Worker, error) {
+	files, err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
 
 	w := &filterWorker{
 		Base:             NewBase(rtype),
 		region:           region_from_cfg(&cfg),
+		cells:            make(map[int]bool),
+		adcs:             make(map[int]bool),
 		runs:             make([]Run, 0),
 		runlst:           make([]Run, 0),
 		cs_atlas_runlst:  make([]int64, 0),
 		run_type:         cfg.RunType,
-		flags:            make(map[int64]string),
+		status:           make(map[int64]*RunStatus),
 		keep_only_active: cfg.KeepOnlyActive,
 		verbose:          cfg.Verbose,
 		update_special:   cfg.UpdateSpecial,
 		allow_c10_err:    cfg.AllowC10Errors,
 		cs_comment:       cfg.CsComment,
-		two_inputs:       two_inputs,
 		filter:           cfg.Filter,
 		amp:              cfg.Amp,
+		loc:              cfg.Location,
+		cs_runs:          make(map[string][]CsRun),
+		cs_data:          make(map[int64]DataMap),
+		run_entries:      files.runs,
+		cfg:              cfg,
+	}
+
+	for _, reg := range w.region {
+		if m := hash_sel_re.FindStringSubmatch(reg); m != nil {
+			hash, _ := strconv.Atoi(m[2])
+			if m[1] == "H" {
+				w.cells[hash] = true
+			} else {
+				w.adcs[hash] = true
+			}
+			continue
+		}
+		w.names = append(w.names, reg)
 	}
 
+	if w.run_type == CesiumRun {
+		w.a_bad = []int{41, 42}
+		w.ma_bad = []int{36, 61}
+		if w.allow_c10_err {
+			w.c_bad = []int{5, 6}
+		} else {
+			w.c_bad = []int{0}
+		}
+		w.d_bad = []int{17, 18}
+		w.md_bad = []int{15, 18}
+		w.period = 7 * 24 * time.Hour // 1 week
+	}
+
+	err = w.init_source(cfg.Source, cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("tucs.Filter: %w", err)
+	}
+	if cfg.Quality != nil {
+		w.quality = append(w.quality, cfg.Quality)
+	}
+	if files.quality != nil {
+		w.quality = append(w.quality, files.quality)
+	}
+	return w, nil
+}
+
+// select_runs fills the list of runs of the filter from the run specification
+// of cfg.
+func (w *filterWorker) select_runs(cfg *FilterCfg) error {
+	var err error
 	iruns := []int64{}
-	//fmt.Printf("run=%v (%T) run2=%v 2-inputs=%v\n", run, run, run2, two_inputs)
-	//fmt.Printf("use-date-prog: %v\n", cfg.UseDateProg)
+	listed := make(map[int64]RunEntry) // runs from a run file
+	ranged := make(map[int64]RunInfo)  // known runs of the ranges of a run file
+
+	w.runs = make([]Run, 0)
+	w.status = make(map[int64]*RunStatus)
+	w.cs_atlas_runlst = make([]int64, 0)
+	w.cs_refs = nil
+	w.cs_runs = make(map[string][]CsRun)
+	w.cs_data = make(map[int64]DataMap)
 
 	// run-nbr selection
-	if two_inputs {
-		// charge injection for 2 dates
-		if run, ok := run.(string); ok {
-			if cfg.UseDateProg {
-				iruns = w.date_prog(run, run2.(string))
-			} else if _, ferr := os.Stat(run); ferr == nil {
-				iruns = runs_from_file(run)
+	spec := cfg.Runs
+	switch spec.kind {
+	case run_spec_numbers:
+		iruns = append(iruns, spec.runs...)
+	case run_spec_file:
+		for _, entry := range w.run_entries {
+			infos := []RunInfo{{Number: entry.First}}
+			if entry.IsRange() {
+				// ranges only select the runs known to the run database,
+				// of the run type of the entry if any
+				infos, err = w.src.RunRange(entry.First, entry.Last)
+				if err != nil {
+					return err
+				}
 			}
-		}
-	} else {
-		// laser or cesium or charge injection for a single date
-		switch r := run.(type) {
-		case int64:
-			iruns = append(iruns, r)
-		case []int64:
-			iruns = append(iruns, r...)
-		case string:
-			if cfg.UseDateProg {
-				iruns = w.date_prog(r, "")
-			} else if _, ferr := os.Stat(r); ferr == nil {
-				iruns = runs_from_file(r)
+			for _, info := range infos {
+				if entry.IsRange() && entry.Type != "" && info.Type != string(entry.Type) {
+					continue
+				}
+				if _, dup := listed[info.Number]; !dup {
+					iruns = append(iruns, info.Number)
+				}
+				listed[info.Number] = entry
+				if entry.IsRange() {
+					ranged[info.Number] = info
+				}
 			}
 		}
+	case run_spec_since, run_spec_between:
+		// laser or cesium or charge injection since a date,
+		// or between 2 dates
+		iruns, err = w.date_prog(spec)
+		if err != nil {
+			return err
+		}
 	}
 
 	// select only the last run
-	if cfg.GetLast {
+	if cfg.GetLast && len(iruns) > 0 {
 		//FIXME: there was this additional check in tucs.worker.Use.py...
 		//if _, ok := run.(string); ok {
 		runmax := int64(0)
@@ -124,303 +214,599 @@ func NewFilter(rtype RegionType, cfg FilterCfg) Worker {
 		//}
 	}
 
-	db, err := sql.Open("mysql", "tcp:pcata007.cern.ch:3306*tile/reader/")
-	if err != nil {
-		panic("tucs.Filter.OpenSql: " + err.Error())
-	}
-	defer db.Close()
-
-	if w.run_type == "cesium" {
+	if w.run_type == CesiumRun {
 		// cesium: each channel may have its own list of runs
 		// as the runs are not partition-wide...
-		for _, irun := range iruns {
-			//fmt.Printf("--> irun=%v\n", irun)
-			if irun > 40000 {
-				rows, err := db.Query(
-					`SELECT date FROM tile.comminfo WHERE run>=? ORDER BY run DESC LIMIT 1`,
-					irun)
-				if err != nil {
-					panic("tucs.Filter.Sql.Query: " + err.Error())
-				}
-				for rows.Next() {
-					var date time.Time
-					err = rows.Scan(&date)
-					if err != nil {
-						panic("tucs.Filter.Sql.Scan: " + err.Error())
-					}
-					fmt.Printf("date: %v\n", date)
-					w.runs = append(w.runs,
-						Run{
-							Type:   w.run_type,
-							Number: irun,
-							Time:   date,
-							Data:   make(DataMap),
-						})
+		return w.select_cs_runs(iruns)
+	}
+
+	for _, irun := range iruns {
+		//fmt.Printf("--> irun=%v\n", irun)
+		info, ok := ranged[irun]
+		if !ok {
+			info, ok, err = w.src.Run(irun)
+			if err != nil {
+				return err
+			}
+		}
+		irun2 := info.Number
+		rtype := info.Type
+		date := info.Date
+		digifrags := info.DigiFrags
+		entry, in_file := listed[irun]
+		if !ok {
+			irun2 = irun
+			date = time.Unix(0, 0) // FIXME: better default ?
+			if in_file {
+				rtype = string(entry.Type)
+				if !entry.Time.IsZero() {
+					date = entry.Time
 				}
-			} else {
-				w.runs = append(w.runs,
-					Run{
-						Type:   w.run_type,
-						Number: irun,
-						Time:   time.Unix(0, 0), //FIXME: better default ?
-						Data:   make(DataMap),
-					})
 			}
+		} else if in_file && entry.Type != "" && string(entry.Type) != rtype {
+			fmt.Printf("**warning** tucs.Filter: run %d listed as %q (line %d) but recorded as %q\n",
+				irun, entry.Type, entry.Line, rtype)
 		}
-	} else {
-		for _, irun := range iruns {
-			//fmt.Printf("--> irun=%v\n", irun)
-			rows, err := db.Query(`select run, type, date, digifrags from tile.comminfo where run=?`,
-				irun)
+		//fmt.Printf("==> %v, %v, %v, #%v\n", irun2, rtype, date, len(digifrags))
+		if cfg.RunType == AllRuns || string(cfg.RunType) == rtype || rtype == "" {
+			data := make(DataMap)
+			if ok {
+				data[RunInfoKey] = info
+			}
+			run := Run{
+				Type:   rtype,
+				Number: irun2,
+				Time:   date,
+				Data:   data,
+			}
+			bads, err := w.bad_runs(irun)
 			if err != nil {
-				panic("tucs.Filter.Sql.Query: " + err.Error())
+				return err
 			}
-			irun2 := int64(-1)
-			rtype := ""
-			date := time.Unix(0, 0) // FIXME: better default ?
-			digifrags := ""
-			if !rows.Next() {
-				irun2 = irun
-			} else {
-				err = rows.Scan(&irun2, &rtype, &date, &digifrags)
+			if len(bads) > 0 {
+				data[RunQualityKey] = bads
 			}
-			//fmt.Printf("==> %v, %v, %v, #%v\n", irun2, rtype, date, len(digifrags))
-			if cfg.RunType == "all" || cfg.RunType == rtype || rtype == "" {
-				w.runs = append(w.runs,
-					Run{
-						Type:   rtype,
-						Number: irun2,
-						Time:   date,
-						Data:   make(DataMap),
-					})
+			if bad, drop := global_bad_run(bads); drop {
+				fmt.Printf("tucs.Filter: dropping %v\n", bad)
+				DroppedRuns = append(DroppedRuns, run)
+				continue
 			}
-			if w.keep_only_active && (rtype == cfg.RunType || rtype == "") {
-				if w.verbose || (len(digifrags)/6 != 256) {
-					fmt.Printf("in run %v, modules in readout: %v\n",
-						irun, len(digifrags)/6)
-				}
-				if len(digifrags) == 0 {
-					// turn off filter for active detector elements
-					w.keep_only_active = false
-				}
-				w.flags[irun] = digifrags
+			for _, bad := range bads {
+				fmt.Printf("tucs.Filter: partially excluding %v\n", bad)
 			}
+			w.runs = append(w.runs, run)
+		}
+		if w.keep_only_active && (rtype == string(cfg.RunType) || rtype == "") {
+			st, err := ParseDigiFrags(irun, digifrags)
+			if err != nil {
+				return fmt.Errorf("tucs.Filter: %w", err)
+			}
+			if w.verbose || st.NumActive() != 256 {
+				fmt.Printf("in run %v, modules in readout: %v\n",
+					irun, st.NumActive())
+			}
+			if !st.Known() {
+				// turn off filter for active detector elements
+				w.keep_only_active = false
+			}
+			w.status[irun] = st
 		}
 	}
-	return w
+	return nil
 }
 
-func region_from_cfg(cfg *FilterCfg) []string {
-	regions := []string{}
-	if len(cfg.Region) == 0 {
-		return regions
+// bad_runs returns the run quality entries of run irun from all the
+// registries.
+func (w *filterWorker) bad_runs(irun int64) ([]BadRun, error) {
+	var bads []BadRun
+	srcs := w.quality
+	if qsrc, ok := w.src.(RunQualitySource); ok {
+		srcs = append([]RunQualitySource{qsrc}, srcs...)
 	}
-	if strings.Contains(cfg.Region, ",") {
-		regions = strings.Split(cfg.Region, ",")
-	} else {
-		regions = append(regions, cfg.Region)
+	for _, qsrc := range srcs {
+		lst, err := qsrc.BadRuns(irun)
+		if err != nil {
+			return nil, err
+		}
+		bads = append(bads, lst...)
 	}
+	return bads, nil
+}
 
-	if regions[0][0] == 'H' {
-		// FIXME
-		panic("tucs.Filter: converting from cell-hash is not implemented")
+// global_bad_run returns the first entry of bads excluding the whole
+// detector, if any.
+func global_bad_run(bads []BadRun) (BadRun, bool) {
+	for _, b := range bads {
+		if b.IsGlobal() {
+			return b, true
+		}
 	}
-	return regions
+	return BadRun{}, false
 }
 
-// translate_runs translates the string form of the runs list into a form that
-// filterWorker can work with
-func translate_runs(cfg *FilterCfg) (run, run2 interface{}, two_inputs bool) {
-	switch r := cfg.Runs.(type) {
-	case int64:
-		two_inputs = false
-		run = r
-		run2 = ""
-
-	case []string:
-		two_inputs = false
-		run = r[0]
-		run2 = ""
-
-	case []int:
-		two_inputs = false
-		run = r
-		run2 = ""
-
-	case string:
-		if !strings.Contains(r, "-") {
-			// it's a date, use date -28days
-			run2 = r
-			run = r + "-28 days"
-			two_inputs = true
-		} else if r[0] == '-' {
-			// check string to see if it is -x days
-			two_inputs = false
-			run = r
-			run2 = ""
-		} else {
-			//fmt.
-		}
-	default:
-		panic(fmt.Sprintf("tucs.Filter: unhandled cfg.Runs type: %T", cfg.Runs))
+// add_cs_run registers the cesium scan number of cs, along with its run
+// quality entries, and returns the Data of its Run.
+// Scans excluded for the whole detector are dropped (see DroppedRuns).
+func (w *filterWorker) add_cs_run(cs CsRun) (DataMap, error) {
+	data := make(DataMap)
+	w.cs_data[cs.Number] = data
+	run := Run{
+		Type:   string(w.run_type),
+		Number: cs.Number,
+		Time:   cs.Time,
+		Data:   data,
+	}
+	bads, err := w.bad_runs(cs.Number)
+	if err != nil {
+		return nil, err
 	}
-	return
+	if len(bads) > 0 {
+		data[RunQualityKey] = bads
+	}
+	if bad, drop := global_bad_run(bads); drop {
+		fmt.Printf("tucs.Filter: dropping %v\n", bad)
+		DroppedRuns = append(DroppedRuns, run)
+		return data, nil
+	}
+	for _, bad := range bads {
+		fmt.Printf("tucs.Filter: partially excluding %v\n", bad)
+	}
+	w.runs = append(w.runs, run)
+	return data, nil
 }
 
-func (w *filterWorker) date_prog(run, run2 string) []int64 {
-	iruns := []int64{}
-	var date time.Time
-	var date2 time.Time
-	var err error
-	if w.two_inputs == false {
-		cmd := exec.Command("date", "-d", run, "--rfc-2822")
-		if cmd == nil {
-			panic("tucs.Filter.date_prog: could not create command 'date'")
+// select_cs_runs builds the per-module lists of cesium scans for the requested
+// runs. ATLAS run numbers (> 40000) select the scans taken within w.period of
+// that run, other numbers are cesium scan numbers.
+// The run quality registries apply to the cesium scan numbers: the scans
+// excluded for the partition of their module are ignored.
+func (w *filterWorker) select_cs_runs(iruns []int64) error {
+	var (
+		begin  time.Time
+		end    time.Time
+		csnbrs = []int64{}
+		csruns = []CsRun{}
+	)
+
+	for _, irun := range iruns {
+		if irun <= 40000 {
+			csnbrs = append(csnbrs, irun)
+			continue
 		}
-		out, err := cmd.CombinedOutput()
+		date, ok, err := w.src.RunDate(irun)
 		if err != nil {
-			fmt.Printf("err: %v\n", string(out))
-			panic("tucs.Filter.date_prog: " + err.Error())
+			return err
+		}
+		if !ok {
+			fmt.Printf("**warning** tucs.Filter: no date for run %d, removing it\n", irun)
+			continue
+		}
+		if w.verbose {
+			fmt.Printf("run %d: %v\n", irun, date)
 		}
-		datestr := strings.Trim(string(out), " \n\r")
-		date, err = time.Parse(time.RFC1123Z, datestr)
+		w.cs_atlas_runlst = append(w.cs_atlas_runlst, irun)
+		w.cs_refs = append(w.cs_refs, Run{
+			Type:   string(w.run_type),
+			Number: irun,
+			Time:   date,
+			Data:   make(DataMap),
+		})
+		if begin.IsZero() || date.Before(begin) {
+			begin = date
+		}
+		if date.After(end) {
+			end = date
+		}
+	}
+
+	if len(w.cs_atlas_runlst) > 0 {
+		lst, err := w.src.CsRuns(RunQuery{
+			Type:      w.run_type,
+			Begin:     begin.Add(-w.period),
+			End:       end.Add(w.period),
+			CsComment: w.cs_comment,
+		})
 		if err != nil {
-			panic("tucs.Filter.date_prog: " + err.Error())
+			return err
 		}
-	} else {
-		{
-			cmd := exec.Command("date", "-d", run, "--rfc-2822")
-			if cmd == nil {
-				panic("tucs.Filter.date_prog: could not create command 'date'")
+		csruns = append(csruns, lst...)
+	}
+
+	if len(csnbrs) > 0 {
+		lst, err := w.src.CsRuns(RunQuery{
+			Type:      w.run_type,
+			CsComment: w.cs_comment,
+			Numbers:   csnbrs,
+		})
+		if err != nil {
+			return err
+		}
+		csruns = append(csruns, lst...)
+
+		// a cesium scan is its own reference run
+		for _, irun := range csnbrs {
+			ref := Run{
+				Type:   string(w.run_type),
+				Number: irun,
+				Time:   time.Unix(0, 0), //FIXME: better default ?
+				Data:   make(DataMap),
 			}
-			out, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("err: %v\n", string(out))
-				panic("tucs.Filter.date_prog: " + err.Error())
+			for _, cs := range lst {
+				if cs.Number == irun {
+					ref.Time = cs.Time
+					break
+				}
 			}
-			datestr := strings.Trim(string(out), " \n\r")
-			date, err = time.Parse(time.RFC1123Z, datestr)
+			w.cs_refs = append(w.cs_refs, ref)
+		}
+	}
+
+	type scan struct {
+		run int64
+		mod string
+	}
+	seen := make(map[scan]struct{})
+	for _, cs := range csruns {
+		key := fmt.Sprintf("%s_m%02d", cs.Partition, cs.Module)
+		if _, dup := seen[scan{cs.Number, key}]; dup {
+			continue
+		}
+		seen[scan{cs.Number, key}] = struct{}{}
+
+		data, ok := w.cs_data[cs.Number]
+		if !ok {
+			var err error
+			data, err = w.add_cs_run(cs)
 			if err != nil {
-				panic("tucs.Filter.date_prog: " + err.Error())
+				return err
 			}
 		}
-		{
-			cmd := exec.Command("date", "-d", run2, "--rfc-2822")
-			if cmd == nil {
-				panic("tucs.Filter.date_prog: could not create command 'date'")
+		bads, _ := data[RunQualityKey].([]BadRun)
+		if bad, excluded := bad_partition(bads, cs.Partition); excluded {
+			if w.verbose {
+				fmt.Printf("Cesium scan %d excluded by run quality (%s), removing: %v\n",
+					cs.Number, bad.Reason, key)
 			}
-			out, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("err: %v\n", string(out))
-				panic("tucs.Filter.date_prog: " + err.Error())
-			}
-			datestr := strings.Trim(string(out), " \n\r")
-			date2, err = time.Parse(time.RFC1123Z, datestr)
-			if err != nil {
-				panic("tucs.Filter.date_prog: " + err.Error())
+			continue
+		}
+		w.cs_runs[key] = append(w.cs_runs[key], cs)
+	}
+	for _, lst := range w.cs_runs {
+		sort.SliceStable(lst, func(i, j int) bool { return lst[i].Time.Before(lst[j].Time) })
+	}
+	SortRunList(w.runs)
+	return nil
+}
+
+// cs_run returns the cesium scan of module key to use for the reference run
+// ref: the scan itself for cesium scan numbers, the scan closest in time
+// within w.period for ATLAS runs.
+func (w *filterWorker) cs_run(key string, ref Run) (CsRun, bool) {
+	lst := w.cs_runs[key]
+	if ref.Number <= 40000 {
+		for _, cs := range lst {
+			if cs.Number == ref.Number {
+				return cs, true
 			}
 		}
+		return CsRun{}, false
 	}
 
-	//fmt.Printf("date:  %v\ndate2: %v\n", date, date2)
-	db, err := sql.Open("mymysql", "tcp:pcata007.cern.ch:3306*tile/reader/")
-	if err != nil {
-		panic("tucs.Filter.OpenSql: " + err.Error())
+	best := -1
+	dtmin := time.Duration(0)
+	for i, cs := range lst {
+		dt := cs.Time.Sub(ref.Time)
+		if dt < 0 {
+			dt = -dt
+		}
+		if dt > w.period {
+			continue
+		}
+		if best < 0 || dt < dtmin {
+			best = i
+			dtmin = dt
+		}
+	}
+	if best < 0 {
+		return CsRun{}, false
+	}
+	return lst[best], true
+}
+
+// cs_excluded returns whether the cesium calibration of a channel is to be
+// excluded: A16 in the modules with cut-outs, C10 when errors are allowed for
+// it and D5 in the special modules EBA15 and EBC18.
+func (w *filterWorker) cs_excluded(pname string, module, pmt int) bool {
+	if pname != "EBA" && pname != "EBC" {
+		return false
+	}
+	switch {
+	case in_intslice(pmt, w.a_bad) && in_intslice(module, w.ma_bad):
+		return true
+	case in_intslice(pmt, w.c_bad):
+		return true
+	case in_intslice(pmt, w.d_bad) &&
+		((pname == "EBA" && module == w.md_bad[0]) || (pname == "EBC" && module == w.md_bad[1])):
+		return true
+	}
+	return false
+}
+
+// process_cs_region attaches to a channel the cesium scans of its module
+// corresponding to each reference run.
+func (w *filterWorker) process_cs_region(region *Region) error {
+	if region.Type != Readout {
+		return nil
+	}
+	nbr := region.Number(0, 0)
+	if len(nbr) != 3 {
+		// cesium scans are per channel
+		return nil
 	}
-	defer db.Close()
 
-	query := []string{}
-	args := []interface{}{}
+	module := region.Parent(Readout, 0)
+	pname := module.Parent(Readout, 0).Name(0)
+	key := pname + "_" + module.Name(0)
+	hash := region.Hash(0, 0)
 
-	if w.run_type == "Las" {
-		query = append(query, "select run from tile.comminfo where")
-		// special treatment for LASER
-		if w.two_inputs {
-			query = append(query, "date>? and date<?")
-			args = append(args, date, date2)
-		} else {
-			query = append(query, "date>?")
-			args = append(args, date)
+	pmt, err := strconv.Atoi(strings.TrimPrefix(region.Name(1), "p"))
+	if err != nil {
+		return fmt.Errorf("tucs.Filter: invalid PMT name for %q: %w", hash, err)
+	}
+	if w.cs_excluded(pname, nbr[1], pmt) {
+		if w.verbose {
+			fmt.Printf("Special cell, removing: %v\n", hash)
 		}
-		query = append(query, "and")
-		if w.filter == "" || w.filter == " " {
-			query = append(query, "((lasfilter='6' and events>10000) or (lasfilter='8' and events>100000))")
-		} else {
-			switch w.filter {
-			case "6":
-				query = append(query, ` (lasfilter="6" and events>10000)`)
-			case "8":
-				query = append(query, ` (lasfilter="8" and events>100000)`)
-			default:
-				query = append(query, `lasfilter=?`)
-				args = append(args, w.filter)
+		return nil
+	}
+
+	used := make(map[int64]struct{})
+	for _, ref := range w.cs_refs {
+		cs, ok := w.cs_run(key, ref)
+		if !ok {
+			if w.verbose {
+				fmt.Printf("No cesium scan for run %d, removing: %v\n", ref.Number, hash)
 			}
+			continue
 		}
+		if _, dup := used[cs.Number]; dup {
+			continue
+		}
+		used[cs.Number] = struct{}{}
+
+		data := make(DataMap)
+		data["region"] = hash
+		data["ref_run"] = ref.Number
+		data["cs_comment"] = cs.Comment
+		region.AddEvent(Event{
+			Run: Run{
+				Type:   string(w.run_type),
+				Number: cs.Number,
+				Time:   cs.Time,
+				Data:   w.cs_data[cs.Number],
+			},
+			Data: data,
+		})
+	}
+	return nil
+}
+
+var (
+	region_tok_re = regexp.MustCompile(`^(TILECAL|LBA|LBC|EBA|EBC|m\d{0,2}|c\d{0,2}|p\d{0,2}|s(A|BC|D|E)?|t\d{0,2}|MBTS[AC]?\d*|lowgain|highgain|gain)$`)
+	hash_sel_re   = regexp.MustCompile(`^(H|ADC)(\d+)$`) // cell hash or ADC hash
+)
 
-		query = append(query, `and lasreqamp=? and type ='Las' and not (recofrags like '%005%' or recofrags like '%50%' or lasshopen=1 ) and comments is NULL`)
-		args = append(args, w.amp)
+// validate checks the whole configuration and returns an error reporting all
+// the problems found.
+// filter_files holds the files of a FilterCfg, as read by validate.
+type filter_files struct {
+	runs    []RunEntry  // entries of the run file
+	quality *RunQuality // run quality registry file
+}
 
-	} else if w.run_type == "cesium" {
-		query = append(query, `select run from tile.runDescr where time>? and module<65`)
-		args = append(args, date)
-		if w.cs_comment != "" {
-			query = append(query, "and comment=?")
-			args = append(args, w.cs_comment)
+func (cfg *FilterCfg) validate() (filter_files, error) {
+	var files filter_files
+	errs := &ConfigError{Worker: "tucs.Filter"}
+
+	// run specification
+	spec := cfg.Runs
+	switch spec.kind {
+	case run_spec_none:
+		errs.Add("Runs", "no run specified")
+	case run_spec_numbers:
+		if len(spec.runs) == 0 {
+			errs.Add("Runs", "empty list of runs")
 		}
-		if w.two_inputs {
-			query = append(query, `and time<?`)
-			args = append(args, date2)
+	case run_spec_file:
+		entries, err := ReadRunFile(spec.file)
+		if err != nil {
+			errs.Add("Runs", "%v", err)
+		}
+		files.runs = entries
+	case run_spec_since, run_spec_between:
+		now := time.Now()
+		date, err := ParseDate(spec.begin, now, cfg.Location)
+		if err != nil {
+			errs.Add("Runs", "%v", err)
+		}
+		if spec.kind == run_spec_between {
+			date2, err2 := ParseDate(spec.end, now, cfg.Location)
+			if err2 != nil {
+				errs.Add("Runs", "%v", err2)
+			}
+			if err == nil && err2 == nil && !date.Before(date2) {
+				errs.Add("Runs", "empty date range [%v, %v]", date, date2)
+			}
 		}
-	} else if w.run_type == "CIS" && w.two_inputs == true {
-		query = append(query, `select run from title.comminfo where date<? and date>?`)
-		args = append(args, date2, date)
-	} else {
-		query = append(query, `select run from title.comminfo where run<9999999 and date>?`)
-		args = append(args, date)
 	}
 
-	fmt.Printf("%v\n", strings.Join(query, " "))
-	//fmt.Printf("%v %v\n", len(args), args)
-	rows, err := db.Query(strings.Join(query, " "), args...)
-	if err != nil {
-		fmt.Printf("tucs.Filter.QuerySql: %v\n", err.Error())
-		panic(err.Error())
+	// run type
+	if cfg.RunType == "" {
+		errs.Add("RunType", "no run type")
+	} else if _, err := ParseRunType(string(cfg.RunType)); err != nil {
+		errs.Add("RunType", "%v", err)
 	}
-	//fmt.Printf("cols: %v\n", cols)
-	for rows.Next() {
-		irun := int64(-1)
-		err = rows.Scan(&irun)
+
+	// laser filter and amplitude
+	if !cfg.Filter.IsValid() {
+		errs.Add("Filter", "invalid laser filter %d (expected 1 to 8)", int(cfg.Filter))
+	}
+	if cfg.Amp < 0 {
+		errs.Add("Amp", "invalid negative laser amplitude %v", cfg.Amp)
+	}
+	if cfg.RunType == LaserRun && spec.ByDate() && cfg.Amp == 0 {
+		errs.Add("Amp", "laser runs selection by date requires a laser amplitude")
+	}
+
+	// run quality
+	if cfg.QualityFile != "" {
+		q, err := LoadRunQuality(cfg.QualityFile)
 		if err != nil {
-			panic(err.Error())
+			errs.Add("QualityFile", "%v", err)
+		}
+		files.quality = q
+	}
+
+	// run database
+	if cfg.Source == nil {
+		if _, err := cfg.DB.Resolve(); err != nil {
+			errs.Add("DB", "%v", err)
+		}
+	}
+
+	// region
+	if cfg.Region != "" {
+		for _, reg := range strings.Split(cfg.Region, ",") {
+			reg = strings.TrimSpace(reg)
+			switch {
+			case reg == "":
+				errs.Add("Region", "empty region in %q", cfg.Region)
+			case hash_sel_re.MatchString(reg):
+				m := hash_sel_re.FindStringSubmatch(reg)
+				hash, err := strconv.Atoi(m[2])
+				switch {
+				case m[1] == "H" && (err != nil || hash >= NumCellHashes):
+					errs.Add("Region", "region %q: invalid cell hash (expected H0 to H%d)", reg, NumCellHashes-1)
+				case m[1] == "ADC" && (err != nil || hash >= NumADCHashes):
+					errs.Add("Region", "region %q: invalid ADC hash (expected ADC0 to ADC%d)", reg, NumADCHashes-1)
+				}
+			default:
+				for _, tok := range strings.Split(reg, "_") {
+					if !region_tok_re.MatchString(tok) {
+						errs.Add("Region", "region %q: invalid element %q", reg, tok)
+						break
+					}
+				}
+			}
 		}
-		//fmt.Printf("--> %v\n", irun)
-		iruns = append(iruns, irun)
 	}
-	return iruns
+
+	return files, errs.Err()
 }
 
-func runs_from_file(fname string) []int64 {
-	iruns := make([]int64, 0)
-	f, err := os.Open(fname)
-	if err != nil {
-		panic("tucs.Filter: " + err.Error())
+func region_from_cfg(cfg *FilterCfg) []string {
+	regions := []string{}
+	if len(cfg.Region) == 0 {
+		return regions
 	}
-	for {
-		irun := int64(-1)
-		_, err = fmt.Fscanf(f, "%d\n", &irun)
-		if err == io.EOF {
-			break
+	for _, reg := range strings.Split(cfg.Region, ",") {
+		regions = append(regions, strings.TrimSpace(reg))
+	}
+	return regions
+}
+
+// selected returns whether region is part of the region selection: its name
+// contains one of the selected names, or it is (or belongs to) a selected cell,
+// or it is a selected ADC.
+func (w *filterWorker) selected(region *Region) bool {
+	for _, reg := range w.names {
+		if strings.Contains(region.Hash(0, 0), reg) ||
+			strings.Contains(region.Hash(1, 0), reg) {
+			return true
 		}
+	}
+	if len(w.cells) > 0 {
+		if cell := cell_of(region); cell != nil {
+			if hash, err := cell.CellHash(); err == nil && w.cells[hash] {
+				return true
+			}
+		}
+	}
+	if len(w.adcs) > 0 && region.Type == Readout {
+		if hash, err := region.ADCHash(); err == nil && w.adcs[hash] {
+			return true
+		}
+	}
+	return false
+}
+
+// cell_of returns the cell of a cell, channel or ADC region, or nil.
+func cell_of(region *Region) *Region {
+	switch region.Type {
+	case Physical:
+		if strings.HasPrefix(region.Name(0), "t") {
+			return region
+		}
+	case Readout:
+		switch len(region.Number(0, 0)) {
+		case 4: // ADC
+			region = region.Parent(Readout, 0)
+			fallthrough
+		case 3: // channel
+			if cell := region.Parent(Physical, 0); cell != nil && cell.Type == Physical {
+				return cell
+			}
+		}
+	}
+	return nil
+}
+
+// date_prog selects the runs taken during the period of spec.
+func (w *filterWorker) date_prog(spec RunSpec) ([]int64, error) {
+	var (
+		date  time.Time
+		date2 time.Time
+		err   error
+	)
+	now := time.Now()
+	date, err = ParseDate(spec.begin, now, w.loc)
+	if err != nil {
+		return nil, err
+	}
+	if spec.kind == run_spec_between {
+		date2, err = ParseDate(spec.end, now, w.loc)
 		if err != nil {
-			panic("tucs.Filter.ReadLine: " + err.Error())
+			return nil, err
 		}
-		iruns = append(iruns, irun)
 	}
-	return iruns
+
+	//fmt.Printf("date:  %v\ndate2: %v\n", date, date2)
+	q := RunQuery{
+		Type:      w.run_type,
+		Begin:     date,
+		Filter:    w.filter,
+		Amp:       w.amp,
+		CsComment: w.cs_comment,
+	}
+	if spec.kind == run_spec_between {
+		q.End = date2
+	}
+	return w.src.Runs(q)
 }
 
 func (w *filterWorker) ProcessStart() error {
 	var err error = nil
+	err = w.open_source()
+	if err != nil {
+		return fmt.Errorf("tucs.Filter: %w", err)
+	}
+
+	DroppedRuns = make(RunList, 0)
+	err = w.select_runs(&w.cfg)
+	if err != nil {
+		return fmt.Errorf("tucs.Filter: %w", err)
+	}
+
 	printf := fmt.Printf
 	printf("Regions: %v\n", w.region)
 
@@ -439,33 +825,11 @@ func (w *filterWorker) ProcessStart() error {
 		w.runlst = append(w.runlst, run)
 	}
 
-	if w.run_type == "cesium" {
-		w.db, err = sql.Open("mymysql", "tcp:pcata007.cern.ch:3306*tile/reader/")
-		if err != nil {
-			return err
-		}
-		w.a_bad = []int{41, 42}
-		w.ma_bad = []int{36, 61}
-		if w.allow_c10_err {
-			w.c_bad = []int{5, 6}
-		} else {
-			w.c_bad = []int{0}
-		}
-		w.d_bad = []int{17, 18}
-		w.md_bad = []int{15, 18}
-		w.period, err = time.ParseDuration("168h") // = 7*24h = 7 days = 1week
-		if err != nil {
-			return err
-		}
-	}
 	return err
 }
 
 func (w *filterWorker) ProcessStop() error {
-	var err error
-	if w.run_type == "cesium" {
-		err = w.db.Close()
-	}
+	err := w.close_source()
 
 	return err
 }
@@ -474,42 +838,31 @@ func (w *filterWorker) ProcessRegion(region *Region) error {
 	var err error
 	use_region := false
 	if len(w.region) > 0 {
-		for _, reg := range w.region {
-			if strings.Contains(region.Hash(0, 0), reg) ||
-				strings.Contains(region.Hash(1, 0), reg) {
-				use_region = true
-				break
-			}
-		}
+		use_region = w.selected(region)
 	} else {
 		use_region = true
 	}
 
 	if use_region {
-		//TODO
-		if w.run_type == "cesium" {
-			panic("FIXME: not implemented")
-			// nbr := region.Number(1, 0)
-			// if len(nbr) == 3 {
-			// 	module := region.Parent(Readout, 0)
-			// 	if len(module.Events()) == 0 {
-			// 		for _, run := range w.runlst {
-			// 			w.fill_module(module, run)
-			// 		}
-			// 	}
-			// 	for ievt, _ := range module.Events() {
-
-			// 	}
-			// }
+		if w.run_type == CesiumRun {
+			err = w.process_cs_region(region)
+			if err != nil {
+				return err
+			}
 		} else {
 			for _, run := range w.runlst {
 				hash := region.Hash(0, 0)
-				if w.keep_only_active && !w.is_active(hash, run.Number) {
+				if w.keep_only_active && !w.is_active(region, run.Number) {
 					if w.verbose {
 						fmt.Printf("Region not in readout, removing: %v\n",
 							hash)
 					}
-				} else if w.run_type == "Las" {
+				} else if bad, ok := is_bad_region(run.Quality(), region); ok {
+					if w.verbose {
+						fmt.Printf("Region excluded by run quality (%s), removing: %v\n",
+							bad.Reason, hash)
+					}
+				} else if w.run_type == LaserRun {
 					// region is an ADC ?
 					if !strings.Contains(hash, "gain") {
 						continue
@@ -531,55 +884,16 @@ func (w *filterWorker) ProcessRegion(region *Region) error {
 	return err
 }
 
-func (w *filterWorker) is_active(hash string, run int64) bool {
-	v, ok := w.flags[run]
+// is_active returns whether region was in readout during run.
+func (w *filterWorker) is_active(region *Region, run int64) bool {
+	st, ok := w.status[run]
 	if !ok {
 		// region *is* used
 		return true
-	} else {
-		if len(v) == 0 {
-			fmt.Printf("flags[%d]=%v\n", run, v)
-			return true
-		}
-	}
-
-	hex := uint16(0)
-	switch {
-	case strings.Contains(hash, "B"):
-		switch {
-		case strings.Contains(hash, "LBA"):
-			hex = uint16(0x1 << 8)
-		case strings.Contains(hash, "LBC"):
-			hex = uint16(0x2 << 8)
-		case strings.Contains(hash, "EBA"):
-			hex = uint16(0x3 << 8)
-		case strings.Contains(hash, "EBC"):
-			hex = uint16(0x4 << 8)
-		}
-		if strings.Contains(hash, "_m") {
-			idx := strings.Index(hash, "m")
-			if idx == -1 {
-				panic("tucs.Filter.is_active: index logic error")
-			}
-			modstr := hash[idx+1 : idx+3]
-			mod, err := strconv.ParseInt(modstr, 10, 64)
-			if err != nil {
-				panic("tucs.Filter.is_active: parse pb: " + err.Error())
-			}
-			mod -= 1
-			hex += uint16(mod)
-			hexstr := fmt.Sprintf("0x%x", hex)
-			return strings.Contains(w.flags[run], hexstr)
-		}
-	case hash == "TILECAL":
-		return true
-
-	default:
-		fmt.Printf("**error** tucs.Filter: unknown hash: %v\n", hash)
-		return false
 	}
-	panic("unreachable")
+	return st.IsActive(region)
 }
 
-// check filterWorker implements tucs.Worker
+// check filterWorker implements tucs.Worker and tucs.appWorker
 var _ Worker = (*filterWorker)(nil)
+var _ appWorker = (*filterWorker)(nil)
@@ -0,0 +1,235 @@
+package tucs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// test_run_source returns a MemRunSource with a few laser, CIS and physics
+// runs taken in May and June 2012.
+func test_run_source() *MemRunSource {
+	laser := func(irun int64, date time.Time, filter string, events int64, comments string) RunInfo {
+		return RunInfo{
+			Number: irun, Type: "Las", Date: date, EndDate: date.Add(time.Hour),
+			Events: events, LasFilter: filter, LasReqAmp: 23, Comments: comments,
+		}
+	}
+	src := NewMemRunSource([]RunInfo{
+		laser(200001, utc(2012, time.May, 2, 10, 0), "6", 20000, ""),
+		laser(200002, utc(2012, time.May, 3, 10, 0), "8", 50000, ""),
+		laser(200003, utc(2012, time.May, 4, 10, 0), "8", 200000, "laser misfired"),
+		{Number: 200004, Type: "CIS", Date: utc(2012, time.May, 5, 10, 0)},
+		{Number: 200006, Type: "Phys", Date: utc(2012, time.May, 6, 10, 0)},
+		laser(200007, utc(2012, time.May, 7, 10, 0), "6", 20000, ""),
+		laser(200010, utc(2012, time.June, 10, 10, 0), "6", 20000, ""),
+	}, nil)
+	src.AddBadRuns(BadRun{First: 200007, Last: 200007, Reason: LaserMisfire})
+	return src
+}
+
+func TestFilterRuns(t *testing.T) {
+	for _, table := range []struct {
+		name string
+		cfg  FilterCfg
+		want []int64
+	}{
+		{
+			name: "numbers",
+			cfg:  FilterCfg{Runs: RunNumbers(200004, 200001), RunType: AllRuns},
+			want: []int64{200004, 200001},
+		},
+		{
+			name: "numbers-of-type",
+			cfg:  FilterCfg{Runs: RunNumbers(200001, 200004, 200006), RunType: CISRun},
+			want: []int64{200004},
+		},
+		{
+			name: "unknown-run",
+			cfg:  FilterCfg{Runs: SingleRun(999), RunType: LaserRun},
+			want: []int64{999},
+		},
+		{
+			name: "last",
+			cfg:  FilterCfg{Runs: RunNumbers(200001, 200006, 200004), RunType: AllRuns, GetLast: true},
+			want: []int64{200006},
+		},
+		{
+			name: "bad-run",
+			cfg:  FilterCfg{Runs: RunNumbers(200001, 200007), RunType: LaserRun},
+			want: []int64{200001},
+		},
+		{
+			name: "laser-between",
+			cfg:  FilterCfg{Runs: RunsBetween("2012-05-01", "2012-06-01"), RunType: LaserRun, Amp: 23},
+			want: []int64{200001},
+		},
+		{
+			name: "laser-since",
+			cfg:  FilterCfg{Runs: RunsSince("2012-05-01"), RunType: LaserRun, Amp: 23},
+			want: []int64{200001, 200010},
+		},
+		{
+			name: "laser-filter",
+			cfg:  FilterCfg{Runs: RunsSince("2012-05-01"), RunType: LaserRun, Amp: 23, Filter: 8},
+			want: nil,
+		},
+		{
+			name: "cis-between",
+			cfg:  FilterCfg{Runs: RunsBetween("2012-05-01", "2012-05-06"), RunType: CISRun},
+			want: []int64{200004},
+		},
+		{
+			name: "all-between",
+			cfg:  FilterCfg{Runs: RunsBetween("2012-05-04", "2012-06-01"), RunType: AllRuns},
+			want: []int64{200003, 200004, 200006},
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			cfg := table.cfg
+			cfg.Source = test_run_source()
+			cfg.Location = time.UTC
+			w, err := NewFilter(Readout, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.ProcessStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.ProcessStop()
+
+			var got []int64
+			for _, run := range w.(*filterWorker).runs {
+				got = append(got, run.Number)
+			}
+			if !reflect.DeepEqual(got, table.want) {
+				t.Fatalf("got runs %v, want %v", got, table.want)
+			}
+		})
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	w, err := NewFilter(Readout, FilterCfg{
+		Runs:    RunNumbers(200001, 200002),
+		RunType: LaserRun,
+		Region:  "LBA_m01_c00",
+		Source:  test_run_source(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+
+	tilecal := TileCal(false, false)
+	var events []string
+	tilecal.IterRegions(Readout, func(t RegionType, region *Region) error {
+		err := w.ProcessRegion(region)
+		if err != nil {
+			return err
+		}
+		for _, evt := range region.Events() {
+			if _, ok := evt.Run.Info(); !ok {
+				return nil
+			}
+			events = append(events, region.Hash(0, 0))
+		}
+		return nil
+	})
+
+	sort.Strings(events)
+	want := []string{
+		"TILECAL_LBA_m01_c00_highgain", "TILECAL_LBA_m01_c00_highgain",
+		"TILECAL_LBA_m01_c00_lowgain", "TILECAL_LBA_m01_c00_lowgain",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	if got := Runs.Numbers(); !reflect.DeepEqual(got, []int64{200001, 200002}) {
+		t.Fatalf("got global runs %v, want [200001 200002]", got)
+	}
+}
+
+func TestFilterFiles(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs.txt")
+	quality := filepath.Join(dir, "quality.txt")
+	err := os.WriteFile(runs, []byte("200001\n200002 # low filter\n200004\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(quality, []byte("200002 shutter\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewFilter(Readout, FilterCfg{
+		Runs:        RunFile(runs),
+		RunType:     LaserRun,
+		Source:      test_run_source(),
+		QualityFile: quality,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are read once, by NewFilter
+	for _, fname := range []string{runs, quality} {
+		err = os.Remove(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+
+	var got []int64
+	for _, run := range w.(*filterWorker).runs {
+		got = append(got, run.Number)
+	}
+	if want := []int64{200001}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got runs %v, want %v", got, want)
+	}
+}
+
+func TestFilterRunFileRanges(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "runs.txt")
+	err := os.WriteFile(fname, []byte("200001-200006 Las\n200004 Las # recorded as CIS\n200006-200010\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewFilter(Readout, FilterCfg{
+		Runs:    RunFile(fname),
+		RunType: AllRuns,
+		Source:  test_run_source(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+
+	var got []int64
+	for _, run := range w.(*filterWorker).runs {
+		got = append(got, run.Number)
+	}
+	if want := []int64{200001, 200002, 200003, 200004, 200006, 200010}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got runs %v, want %v", got, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -82,6 +83,11 @@ func (r *Region) AddEvent(evt Event) {
 	r.events = append(r.events, evt)
 }
 
+// SetEvents replaces the events of the region, e.g. to drop some of them.
+func (r *Region) SetEvents(evts []Event) {
+	r.events = evts
+}
+
 func (r *Region) Hash(nidx, pidx uint) string {
 	k := fmt.Sprintf("%d_%s_%d", nidx, r.Type, pidx)
 	if hash, ok := r.hashes[k]; ok {
@@ -157,6 +163,71 @@ func (r *Region) SetParent(parents ...*Region) {
 	r.parents = append(r.parents, parents...)
 }
 
+// Clone returns a deep copy of the tree rooted at this Region, including the
+// events attached to each of its sub-regions.
+// Links to parents which are not part of that tree are dropped.
+func (r *Region) Clone() *Region {
+	ctx := cloner{
+		regions: make(map[*Region]*Region),
+		data:    make(map[uintptr]DataMap),
+	}
+	root := ctx.region(r)
+	for orig, c := range ctx.regions {
+		for _, p := range orig.parents {
+			if cp, ok := ctx.regions[p]; ok {
+				c.parents = append(c.parents, cp)
+			}
+		}
+	}
+	return root
+}
+
+// cloner holds the state of a deep copy of a detector tree.
+// Regions and Run.Data maps shared in the original tree stay shared in the copy.
+type cloner struct {
+	regions map[*Region]*Region
+	data    map[uintptr]DataMap
+}
+
+func (ctx *cloner) region(r *Region) *Region {
+	if c, ok := ctx.regions[r]; ok {
+		return c
+	}
+	c := &Region{
+		names:    make([]string, len(r.names)),
+		parents:  make([]*Region, 0, len(r.parents)),
+		children: make([]*Region, 0, len(r.children)),
+		hashes:   make(map[string]string),
+		events:   make([]Event, 0, len(r.events)),
+		Type:     r.Type,
+	}
+	copy(c.names, r.names)
+	ctx.regions[r] = c
+
+	for _, evt := range r.events {
+		run := evt.Run
+		run.Data = ctx.run_data(run.Data)
+		c.events = append(c.events, Event{Run: run, Data: evt.Data.Clone()})
+	}
+	for _, child := range r.children {
+		c.children = append(c.children, ctx.region(child))
+	}
+	return c
+}
+
+func (ctx *cloner) run_data(data DataMap) DataMap {
+	if data == nil {
+		return nil
+	}
+	key := reflect.ValueOf(data).Pointer()
+	if c, ok := ctx.data[key]; ok {
+		return c
+	}
+	c := data.Clone()
+	ctx.data[key] = c
+	return c
+}
+
 // SanityCheck checks whether the internal state of this Region is consistent
 // with all the other Regions it is in relation (parents and children)
 // It returns a non-nil error in case of inconsistency
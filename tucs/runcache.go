@@ -0,0 +1,639 @@
+package tucs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotCached is returned (wrapped) by a CachedRunSource in offline mode when
+// a query result is not in the cache.
+var ErrNotCached = errors.New("tucs: run database query result not cached")
+
+// CacheCfg configures the on-disk cache of run database query results.
+type CacheCfg struct {
+	Dir     string        // cache directory ("" with Offline: DefaultCacheDir)
+	Expiry  time.Duration // age after which cached results are queried again (0: never)
+	Offline bool          // only use the cache, never query the run database
+}
+
+// Enabled returns whether the cache is used.
+func (cfg CacheCfg) Enabled() bool {
+	return cfg.Dir != "" || cfg.Offline
+}
+
+// UnmarshalJSON reads a CacheCfg from its JSON form, where the expiry is a
+// duration string:
+//
+//	{"dir": "/tmp/tucs-cache", "expiry": "24h", "offline": false}
+func (cfg *CacheCfg) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Dir     string `json:"dir"`
+		Expiry  string `json:"expiry"`
+		Offline bool   `json:"offline"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	var expiry time.Duration
+	if raw.Expiry != "" {
+		expiry, err = time.ParseDuration(raw.Expiry)
+		if err != nil {
+			return fmt.Errorf("tucs: invalid cache expiry: %w", err)
+		}
+	}
+	*cfg = CacheCfg{Dir: raw.Dir, Expiry: expiry, Offline: raw.Offline}
+	return nil
+}
+
+// cache_from_env returns the cache settings from the TUCS_CACHE_DIR,
+// TUCS_CACHE_EXPIRY and TUCS_OFFLINE environment variables.
+func cache_from_env() (CacheCfg, error) {
+	var (
+		cfg CacheCfg
+		err error
+	)
+	cfg.Dir = os.Getenv("TUCS_CACHE_DIR")
+	if v := os.Getenv("TUCS_CACHE_EXPIRY"); v != "" {
+		cfg.Expiry, err = time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("tucs: invalid TUCS_CACHE_EXPIRY: %w", err)
+		}
+	}
+	switch strings.ToLower(os.Getenv("TUCS_OFFLINE")) {
+	case "", "0", "false", "no":
+	default:
+		cfg.Offline = true
+	}
+	return cfg, nil
+}
+
+// cache_coverage is a period over which all the runs and cesium scans were
+// stored in the cache by Prefill, along with the range of numbers of the runs
+// taken over that period (zero if there were none).
+type cache_coverage struct {
+	Begin    time.Time `json:"begin"`
+	End      time.Time `json:"end"`
+	FirstRun int64     `json:"first_run,omitempty"`
+	LastRun  int64     `json:"last_run,omitempty"`
+}
+
+// has_run returns whether run irun is within the runs stored over the period.
+func (p cache_coverage) has_run(irun int64) bool {
+	return p.LastRun > 0 && p.FirstRun <= irun && irun <= p.LastRun
+}
+
+// cache_entry is the on-disk form of a cached query result.
+type cache_entry struct {
+	Key   string          `json:"key"`
+	Time  time.Time       `json:"time"` // when the result was stored
+	Value json.RawMessage `json:"value"`
+}
+
+// DefaultCacheDir returns the default directory of the run cache: tucs/rundb
+// under the user cache directory.
+func DefaultCacheDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("tucs: no run cache directory: %w", err)
+	}
+	return filepath.Join(cache, "tucs", "rundb"), nil
+}
+
+// CachedRunSource is a RunSource storing the results of the queries to
+// another RunSource in a directory, so they can be reused offline.
+//
+// Cached results are keyed by query. The dates of the queries by date are
+// truncated to the minute, so that the queries relative to the current time
+// share their results for a minute, and the results of the queries over a
+// period which is not over yet (e.g. RunsSince) are never stored.
+// In offline mode, the queries which were
+// not cached as such are answered from all the cached runs and cesium scans:
+// the queries by date (Runs and CsRuns) provided their beginning is within a
+// period stored by Prefill, the queries by run number (Run, RunDate and
+// DigiFrags) and by range of run numbers (RunRange) provided the run numbers
+// are within the runs of such a period.
+// Runs missing from a stored period are then reported as unknown.
+// Expired results are still used in offline mode.
+type CachedRunSource struct {
+	src RunSource     // nil in offline mode
+	mem *MemRunSource // all the cached runs and cesium scans, loaded on demand in offline mode
+	dir string
+	cfg CacheCfg
+}
+
+// NewCachedRunSource returns a RunSource caching the results of src according
+// to cfg. src may be nil in offline mode.
+func NewCachedRunSource(src RunSource, cfg CacheCfg) (*CachedRunSource, error) {
+	if src == nil && !cfg.Offline {
+		return nil, fmt.Errorf("tucs: no run source to cache")
+	}
+	var err error
+	dir := cfg.Dir
+	if dir == "" {
+		dir, err = DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not create run cache: %w", err)
+	}
+	return &CachedRunSource{src: src, dir: dir, cfg: cfg}, nil
+}
+
+// Dir returns the cache directory.
+func (c *CachedRunSource) Dir() string {
+	return c.dir
+}
+
+type cached_run struct {
+	Info  RunInfo `json:"info"`
+	Found bool    `json:"found"`
+}
+
+type cached_date struct {
+	Date  time.Time `json:"date"`
+	Found bool      `json:"found"`
+}
+
+func (c *CachedRunSource) Run(irun int64) (RunInfo, bool, error) {
+	var v cached_run
+	err := c.fetch("run", fmt.Sprintf("run=%d", irun), &v, func() (interface{}, error) {
+		info, ok, err := c.src.Run(irun)
+		return cached_run{info, ok}, err
+	})
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering_runs(irun, irun, err)
+		if err != nil {
+			return RunInfo{}, false, err
+		}
+		return mem.Run(irun)
+	}
+	return v.Info, v.Found, err
+}
+
+func (c *CachedRunSource) RunRange(first, last int64) ([]RunInfo, error) {
+	var infos []RunInfo
+	err := c.fetch("runrange", fmt.Sprintf("run=%d-%d", first, last), &infos, func() (interface{}, error) {
+		return c.src.RunRange(first, last)
+	})
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering_runs(first, last, err)
+		if err != nil {
+			return nil, err
+		}
+		return mem.RunRange(first, last)
+	}
+	return infos, err
+}
+
+func (c *CachedRunSource) RunDate(irun int64) (time.Time, bool, error) {
+	var v cached_date
+	err := c.fetch("date", fmt.Sprintf("run>=%d", irun), &v, func() (interface{}, error) {
+		date, ok, err := c.src.RunDate(irun)
+		return cached_date{date, ok}, err
+	})
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering_runs(irun, irun, err)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return mem.RunDate(irun)
+	}
+	return v.Date, v.Found, err
+}
+
+func (c *CachedRunSource) Runs(q RunQuery) ([]int64, error) {
+	q, key, err := cached_query(q)
+	if err != nil {
+		return nil, err
+	}
+	if open_query(q) {
+		if c.src != nil {
+			return c.src.Runs(q)
+		}
+		err = fmt.Errorf("%w (runs %s)", ErrNotCached, key)
+	} else {
+		var iruns []int64
+		err = c.fetch("runs", key, &iruns, func() (interface{}, error) {
+			return c.src.Runs(q)
+		})
+		if err == nil {
+			return iruns, nil
+		}
+	}
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering(q, err)
+		if err != nil {
+			return nil, err
+		}
+		return mem.Runs(q)
+	}
+	return nil, err
+}
+
+func (c *CachedRunSource) DigiFrags(irun int64) (string, error) {
+	var digifrags string
+	err := c.fetch("digifrags", fmt.Sprintf("run=%d", irun), &digifrags, func() (interface{}, error) {
+		return c.src.DigiFrags(irun)
+	})
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering_runs(irun, irun, err)
+		if err != nil {
+			return "", err
+		}
+		return mem.DigiFrags(irun)
+	}
+	return digifrags, err
+}
+
+func (c *CachedRunSource) CsRuns(q RunQuery) ([]CsRun, error) {
+	q, key, err := cached_query(q)
+	if err != nil {
+		return nil, err
+	}
+	if open_query(q) {
+		if c.src != nil {
+			return c.src.CsRuns(q)
+		}
+		err = fmt.Errorf("%w (csruns %s)", ErrNotCached, key)
+	} else {
+		var csruns []CsRun
+		err = c.fetch("csruns", key, &csruns, func() (interface{}, error) {
+			return c.src.CsRuns(q)
+		})
+		if err == nil {
+			return csruns, nil
+		}
+	}
+	if errors.Is(err, ErrNotCached) {
+		var mem *MemRunSource
+		mem, err = c.covering(q, err)
+		if err != nil {
+			return nil, err
+		}
+		return mem.CsRuns(q)
+	}
+	return nil, err
+}
+
+// BadRuns implements RunQualitySource for the cached RunSource, if it is one.
+// Runs without cached entries are considered good in offline mode.
+func (c *CachedRunSource) BadRuns(irun int64) ([]BadRun, error) {
+	qsrc, ok := c.src.(RunQualitySource)
+	if !ok && !c.cfg.Offline {
+		return nil, nil
+	}
+	var bads []BadRun
+	err := c.fetch("quality", fmt.Sprintf("run=%d", irun), &bads, func() (interface{}, error) {
+		return qsrc.BadRuns(irun)
+	})
+	if errors.Is(err, ErrNotCached) {
+		return nil, nil
+	}
+	return bads, err
+}
+
+// Close closes the cached RunSource.
+func (c *CachedRunSource) Close() error {
+	if c.src == nil {
+		return nil
+	}
+	return c.src.Close()
+}
+
+// Prefill stores in the cache all the runs taken and cesium scans done
+// between begin and end, along with the run quality entries of the runs if
+// the cached RunSource serves them, so the queries over that period can be
+// answered offline.
+// It returns the number of runs and cesium scans stored.
+func (c *CachedRunSource) Prefill(begin, end time.Time) (nruns, ncsruns int, err error) {
+	if c.src == nil {
+		return 0, 0, fmt.Errorf("tucs: cannot prefill the run cache in offline mode")
+	}
+	if !begin.Before(end) {
+		return 0, 0, fmt.Errorf("tucs: empty prefill period [%v, %v]", begin, end)
+	}
+
+	iruns, err := c.src.Runs(RunQuery{Type: AllRuns, Begin: begin, End: end})
+	if err != nil {
+		return 0, 0, err
+	}
+	qsrc, _ := c.src.(RunQualitySource)
+	period := cache_coverage{Begin: begin, End: end}
+	for _, irun := range iruns {
+		info, ok, err := c.src.Run(irun)
+		if err != nil {
+			return nruns, ncsruns, err
+		}
+		if !ok || info.Date.After(end) {
+			continue
+		}
+		err = c.store("run", fmt.Sprintf("run=%d", irun), cached_run{info, ok})
+		if err != nil {
+			return nruns, ncsruns, err
+		}
+		err = c.store("date", fmt.Sprintf("run>=%d", irun), cached_date{info.Date, ok})
+		if err != nil {
+			return nruns, ncsruns, err
+		}
+		err = c.store("digifrags", fmt.Sprintf("run=%d", irun), info.DigiFrags)
+		if err != nil {
+			return nruns, ncsruns, err
+		}
+		if qsrc != nil {
+			bads, err := qsrc.BadRuns(irun)
+			if err != nil {
+				return nruns, ncsruns, err
+			}
+			err = c.store("quality", fmt.Sprintf("run=%d", irun), bads)
+			if err != nil {
+				return nruns, ncsruns, err
+			}
+		}
+		if period.LastRun == 0 || irun < period.FirstRun {
+			period.FirstRun = irun
+		}
+		if irun > period.LastRun {
+			period.LastRun = irun
+		}
+		nruns++
+	}
+
+	q, key, err := cached_query(RunQuery{Type: CesiumRun, Begin: begin, End: end})
+	if err != nil {
+		return nruns, ncsruns, err
+	}
+	csruns, err := c.src.CsRuns(q)
+	if err != nil {
+		return nruns, ncsruns, err
+	}
+	if !open_query(q) {
+		err = c.store("csruns", key, csruns)
+	}
+	if err != nil {
+		return nruns, ncsruns, err
+	}
+	ncsruns = len(csruns)
+
+	var cover []cache_coverage
+	_, err = c.load("coverage", "coverage", &cover)
+	if err != nil {
+		return nruns, ncsruns, err
+	}
+	cover = append(cover, period)
+	err = c.store("coverage", "coverage", cover)
+	return nruns, ncsruns, err
+}
+
+// fetch loads the result of the query key of the given kind into v, from the
+// cache if possible, from the cached RunSource otherwise.
+func (c *CachedRunSource) fetch(kind, key string, v interface{}, query func() (interface{}, error)) error {
+	stored, err := c.load(kind, key, v)
+	if err != nil {
+		return err
+	}
+	fresh := !stored.IsZero() && (c.cfg.Expiry <= 0 || time.Since(stored) < c.cfg.Expiry)
+	switch {
+	case fresh:
+		return nil
+	case c.cfg.Offline && !stored.IsZero():
+		// better stale than nothing
+		return nil
+	case c.cfg.Offline:
+		return fmt.Errorf("%w (%s %s)", ErrNotCached, kind, key)
+	}
+
+	res, err := query()
+	if err != nil {
+		return err
+	}
+	err = c.store(kind, key, res)
+	if err != nil {
+		return err
+	}
+	// round-trip through JSON so cached and fresh results are identical
+	buf, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// covering returns a MemRunSource holding all the cached runs and cesium
+// scans, if the beginning of the period of q was stored by Prefill.
+// It returns miss otherwise.
+func (c *CachedRunSource) covering(q RunQuery, miss error) (*MemRunSource, error) {
+	end := q.End
+	if end.IsZero() {
+		end = q.Begin
+	}
+	return c.covered(miss, func(p cache_coverage) bool {
+		return !q.Begin.Before(p.Begin) && !end.After(p.End)
+	})
+}
+
+// covering_runs returns a MemRunSource holding all the cached runs and cesium
+// scans, if the runs numbered from first to last are within the runs of a
+// period stored by Prefill.
+// It returns miss otherwise.
+func (c *CachedRunSource) covering_runs(first, last int64, miss error) (*MemRunSource, error) {
+	return c.covered(miss, func(p cache_coverage) bool {
+		return p.has_run(first) && p.has_run(last)
+	})
+}
+
+// covered returns a MemRunSource holding all the cached runs and cesium
+// scans, if one of the periods stored by Prefill satisfies match.
+// It returns miss otherwise.
+func (c *CachedRunSource) covered(miss error, match func(p cache_coverage) bool) (*MemRunSource, error) {
+	var cover []cache_coverage
+	_, err := c.load("coverage", "coverage", &cover)
+	if err != nil {
+		return nil, err
+	}
+	ok := false
+	for _, p := range cover {
+		if match(p) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, miss
+	}
+	if c.mem == nil {
+		c.mem, err = c.cached()
+	}
+	return c.mem, err
+}
+
+// cached returns a MemRunSource holding all the cached runs and cesium scans.
+func (c *CachedRunSource) cached() (*MemRunSource, error) {
+	var (
+		infos  []RunInfo
+		csruns []CsRun
+	)
+	err := c.walk("run", func(raw json.RawMessage) error {
+		var v cached_run
+		err := json.Unmarshal(raw, &v)
+		if err == nil && v.Found {
+			infos = append(infos, v.Info)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type scan struct {
+		run  int64
+		part string
+		mod  int
+	}
+	seen := make(map[scan]struct{})
+	err = c.walk("csruns", func(raw json.RawMessage) error {
+		var v []CsRun
+		err := json.Unmarshal(raw, &v)
+		for _, cs := range v {
+			k := scan{cs.Number, cs.Partition, cs.Module}
+			if _, dup := seen[k]; dup {
+				continue
+			}
+			seen[k] = struct{}{}
+			csruns = append(csruns, cs)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewMemRunSource(infos, csruns), nil
+}
+
+// cached_query returns the query by date q with its dates truncated to the
+// minute, as it is queried and cached, along with its cache key.
+func cached_query(q RunQuery) (RunQuery, string, error) {
+	q.Begin = q.Begin.Truncate(time.Minute).UTC()
+	q.End = q.End.Truncate(time.Minute).UTC()
+	buf, err := json.Marshal(q)
+	if err != nil {
+		return q, "", fmt.Errorf("tucs: could not encode run query: %w", err)
+	}
+	return q, string(buf), nil
+}
+
+// open_query returns whether the period of the query by date q is not over
+// yet, so more runs may match it later on.
+func open_query(q RunQuery) bool {
+	return q.End.IsZero() || !q.End.Before(time.Now())
+}
+
+func (c *CachedRunSource) fname(kind, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:16])+".json")
+}
+
+// load reads the cached result of the query key of the given kind into v.
+// It returns the time the result was stored, or the zero time if it is not
+// in the cache.
+func (c *CachedRunSource) load(kind, key string, v interface{}) (time.Time, error) {
+	buf, err := os.ReadFile(c.fname(kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("tucs: could not read run cache: %w", err)
+	}
+	var entry cache_entry
+	err = json.Unmarshal(buf, &entry)
+	if err == nil {
+		err = json.Unmarshal(entry.Value, v)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("tucs: invalid run cache entry %q: %w", c.fname(kind, key), err)
+	}
+	if entry.Key != key {
+		// hash collision: treat as a miss
+		return time.Time{}, nil
+	}
+	return entry.Time, nil
+}
+
+// store writes the result v of the query key of the given kind in the cache.
+func (c *CachedRunSource) store(kind, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("tucs: could not encode run cache entry: %w", err)
+	}
+	buf, err := json.Marshal(cache_entry{Key: key, Time: time.Now(), Value: value})
+	if err != nil {
+		return fmt.Errorf("tucs: could not encode run cache entry: %w", err)
+	}
+
+	fname := c.fname(kind, key)
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return fmt.Errorf("tucs: could not write run cache: %w", err)
+	}
+	// write then rename, so concurrent readers never see partial entries
+	f, err := os.CreateTemp(filepath.Dir(fname), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("tucs: could not write run cache: %w", err)
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("tucs: could not write run cache: %w", err)
+	}
+	return nil
+}
+
+// walk calls fct with the value of every cached result of the given kind.
+func (c *CachedRunSource) walk(kind string, fct func(raw json.RawMessage) error) error {
+	fnames, err := filepath.Glob(filepath.Join(c.dir, kind, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, fname := range fnames {
+		buf, err := os.ReadFile(fname)
+		if err != nil {
+			return fmt.Errorf("tucs: could not read run cache: %w", err)
+		}
+		var entry cache_entry
+		err = json.Unmarshal(buf, &entry)
+		if err == nil {
+			err = fct(entry.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("tucs: invalid run cache entry %q: %w", fname, err)
+		}
+	}
+	return nil
+}
+
+// check CachedRunSource implements tucs.RunSource
+var _ RunSource = (*CachedRunSource)(nil)
+var _ RunQualitySource = (*CachedRunSource)(nil)
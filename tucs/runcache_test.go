@@ -0,0 +1,61 @@
+package tucs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// counting_source is a RunSource counting its queries by date
+type counting_source struct {
+	*MemRunSource
+	n int
+}
+
+func (src *counting_source) Runs(q RunQuery) ([]int64, error) {
+	src.n++
+	return src.MemRunSource.Runs(q)
+}
+
+func TestCachedRunSourceQueries(t *testing.T) {
+	dir := t.TempDir()
+	src := &counting_source{MemRunSource: test_run_source()}
+	c, err := NewCachedRunSource(src, CacheCfg{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same query, a few seconds apart, is cached once
+	begin := utc(2012, time.May, 1, 10, 0)
+	for _, dt := range []time.Duration{0, 2 * time.Second, 5 * time.Second} {
+		iruns, err := c.Runs(RunQuery{Type: LaserRun, Amp: 23, Begin: begin.Add(dt), End: begin.Add(40*24*time.Hour + dt)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(iruns) != 2 {
+			t.Fatalf("got runs %v, want 2 runs", iruns)
+		}
+	}
+	if src.n != 1 {
+		t.Fatalf("got %d queries, want 1", src.n)
+	}
+
+	// periods not over yet are not cached
+	for i := 0; i < 2; i++ {
+		_, err = c.Runs(RunQuery{Type: LaserRun, Amp: 23, Begin: begin})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if src.n != 3 {
+		t.Fatalf("got %d queries, want 3", src.n)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d cached queries, want 1", len(entries))
+	}
+}
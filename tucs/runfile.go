@@ -0,0 +1,254 @@
+package tucs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// max_run_range is the maximum number of runs a single range of a run list
+// may span.
+const max_run_range = 100000
+
+// RunEntry is an entry of a run list file: a single run or an inclusive range
+// of runs, with an optional run type and date.
+type RunEntry struct {
+	First int64     // first run number
+	Last  int64     // last run number (== First for a single run)
+	Type  RunType   // run type, "" if not given
+	Time  time.Time // date of the run, zero if not given
+	Line  int       // line of the entry (of its opening brace in JSON format)
+}
+
+// IsRange returns whether the entry is a range of runs.
+func (e RunEntry) IsRange() bool {
+	return e.Last != e.First
+}
+
+// Numbers returns the run numbers of the entry.
+func (e RunEntry) Numbers() []int64 {
+	iruns := make([]int64, 0, e.Last-e.First+1)
+	for irun := e.First; irun <= e.Last; irun++ {
+		iruns = append(iruns, irun)
+	}
+	return iruns
+}
+
+// ReadRunFile reads a run list file.
+// Files with a ".json" extension, or whose content starts with '[', are read
+// with ParseRunListJSON, the other ones with ParseRunList.
+func ReadRunFile(fname string) ([]RunEntry, error) {
+	buf, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not read run file: %w", err)
+	}
+
+	var entries []RunEntry
+	if strings.EqualFold(filepath.Ext(fname), ".json") ||
+		bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		entries, err = ParseRunListJSON(bytes.NewReader(buf))
+	} else {
+		entries, err = ParseRunList(bytes.NewReader(buf))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tucs: invalid run file %q: %w", fname, err)
+	}
+	return entries, nil
+}
+
+// ParseRunList parses a run list in text format: one run or range of runs
+// per line, optionally followed by a run type and a date (in CERN local time,
+// unless a time zone is given).
+// In a Filter, a range with a run type only selects the runs of that type.
+// Everything after a '#' is a comment, blank lines are ignored:
+//
+//	# laser runs of May 2012
+//	212000
+//	212000-212100
+//	212345 Las
+//	212346 Las 2012-05-01
+//	212347 CIS 2012-05-01 14:30
+func ParseRunList(r io.Reader) ([]RunEntry, error) {
+	entries := make([]RunEntry, 0)
+	scan := bufio.NewScanner(r)
+	line := 0
+	for scan.Scan() {
+		line++
+		txt := scan.Text()
+		if i := strings.Index(txt, "#"); i >= 0 {
+			txt = txt[:i]
+		}
+		fields := strings.Fields(txt)
+		if len(fields) == 0 {
+			continue
+		}
+
+		entry, err := parse_run_range(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry.Line = line
+		if len(fields) > 1 {
+			entry.Type, err = ParseRunType(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if len(fields) > 2 {
+			entry.Time, err = parse_run_date(strings.Join(fields[2:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return entries, nil
+}
+
+// ParseRunListJSON parses a run list in JSON format: an array of entries,
+// where "run" is a run number or a range of runs, and "type" and "date" are
+// optional:
+//
+//	[
+//	  {"run": 212000},
+//	  {"run": "212000-212100", "type": "Las"},
+//	  {"run": 212346, "type": "Las", "date": "2012-05-01"}
+//	]
+func ParseRunListJSON(r io.Reader) ([]RunEntry, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, json_error(buf, 1, err)
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("line %d: expected an array of entries", json_line(buf, dec.InputOffset()))
+	}
+
+	entries := make([]RunEntry, 0)
+	for dec.More() {
+		line := json_line(buf, json_skip(buf, dec.InputOffset()))
+		var v struct {
+			Run  json.RawMessage `json:"run"`
+			Type string          `json:"type"`
+			Date string          `json:"date"`
+		}
+		err = dec.Decode(&v)
+		if err != nil {
+			return nil, json_error(buf, line, err)
+		}
+
+		var (
+			entry RunEntry
+			num   int64
+			str   string
+		)
+		switch {
+		case len(v.Run) == 0:
+			err = fmt.Errorf("missing run")
+		case json.Unmarshal(v.Run, &num) == nil:
+			entry = RunEntry{First: num, Last: num}
+			if num <= 0 {
+				err = fmt.Errorf("invalid run number %d", num)
+			}
+		case json.Unmarshal(v.Run, &str) == nil:
+			entry, err = parse_run_range(str)
+		default:
+			err = fmt.Errorf("invalid run %s", v.Run)
+		}
+		if err == nil && v.Type != "" {
+			entry.Type, err = ParseRunType(v.Type)
+		}
+		if err == nil && v.Date != "" {
+			entry.Time, err = parse_run_date(v.Date)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry.Line = line
+		entries = append(entries, entry)
+	}
+	_, err = dec.Token()
+	if err != nil {
+		return nil, json_error(buf, json_line(buf, dec.InputOffset()), err)
+	}
+	return entries, nil
+}
+
+// parse_run_range parses a run number ("212000") or an inclusive range of run
+// numbers ("212000-212100").
+func parse_run_range(s string) (RunEntry, error) {
+	var entry RunEntry
+	first, last := s, s
+	if i := strings.Index(s, "-"); i > 0 {
+		first, last = s[:i], s[i+1:]
+	}
+	var err error
+	entry.First, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || entry.First <= 0 {
+		return entry, fmt.Errorf("invalid run number %q", first)
+	}
+	entry.Last, err = strconv.ParseInt(last, 10, 64)
+	if err != nil || entry.Last <= 0 {
+		return entry, fmt.Errorf("invalid run number %q", last)
+	}
+	switch {
+	case entry.Last < entry.First:
+		return entry, fmt.Errorf("invalid run range %q (decreasing)", s)
+	case entry.Last-entry.First >= max_run_range:
+		return entry, fmt.Errorf("invalid run range %q (more than %d runs)", s, max_run_range)
+	}
+	return entry, nil
+}
+
+// parse_run_date parses the absolute date of a run list entry.
+func parse_run_date(s string) (time.Time, error) {
+	if !date_abs_re.MatchString(strings.ToLower(s)) {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD [hh:mm[:ss]])", s)
+	}
+	return ParseDate(s, time.Time{}, CERN)
+}
+
+// json_error locates err, returned while decoding the JSON buf, at its own
+// offset for syntax errors and at line otherwise.
+func json_error(buf []byte, line int, err error) error {
+	if e, ok := err.(*json.SyntaxError); ok {
+		line = json_line(buf, e.Offset)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("line %d: unexpected end of JSON input", json_line(buf, int64(len(buf))))
+	}
+	return fmt.Errorf("line %d: %w", line, err)
+}
+
+// json_skip returns the offset of the first byte of buf from off which is
+// neither blank nor a comma, i.e. the beginning of the next JSON array element.
+func json_skip(buf []byte, off int64) int64 {
+	for off < int64(len(buf)) && bytes.IndexByte([]byte(" \t\r\n,"), buf[off]) >= 0 {
+		off++
+	}
+	return off
+}
+
+// json_line returns the line number of the byte offset off of buf.
+func json_line(buf []byte, off int64) int {
+	if off > int64(len(buf)) {
+		off = int64(len(buf))
+	}
+	return bytes.Count(buf[:off], []byte("\n")) + 1
+}
@@ -0,0 +1,245 @@
+package tucs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Runs are identified by their run number in all the RunList set operations.
+
+// Numbers returns the run numbers of this RunList.
+func (r RunList) Numbers() []int64 {
+	iruns := make([]int64, len(r))
+	for i, run := range r {
+		iruns[i] = run.Number
+	}
+	return iruns
+}
+
+// Contains returns whether this RunList holds run number irun.
+func (r RunList) Contains(irun int64) bool {
+	for _, run := range r {
+		if run.Number == irun {
+			return true
+		}
+	}
+	return false
+}
+
+// run_set returns the set of run numbers of r.
+func (r RunList) run_set() map[int64]struct{} {
+	set := make(map[int64]struct{}, len(r))
+	for _, run := range r {
+		set[run.Number] = struct{}{}
+	}
+	return set
+}
+
+// Dedup returns the runs of this RunList, keeping only the first occurrence of
+// each run number.
+func (r RunList) Dedup() RunList {
+	seen := make(map[int64]struct{}, len(r))
+	lst := make(RunList, 0, len(r))
+	for _, run := range r {
+		if _, dup := seen[run.Number]; dup {
+			continue
+		}
+		seen[run.Number] = struct{}{}
+		lst = append(lst, run)
+	}
+	return lst
+}
+
+// Union returns the runs of this RunList followed by the runs of o it does
+// not hold, without duplicates.
+func (r RunList) Union(o RunList) RunList {
+	lst := make(RunList, 0, len(r)+len(o))
+	lst = append(lst, r...)
+	lst = append(lst, o...)
+	return lst.Dedup()
+}
+
+// Intersect returns the runs of this RunList which are also in o, without
+// duplicates.
+func (r RunList) Intersect(o RunList) RunList {
+	set := o.run_set()
+	lst := make(RunList, 0, len(r))
+	for _, run := range r {
+		if _, ok := set[run.Number]; ok {
+			lst = append(lst, run)
+		}
+	}
+	return lst.Dedup()
+}
+
+// Difference returns the runs of this RunList which are not in o, without
+// duplicates.
+func (r RunList) Difference(o RunList) RunList {
+	set := o.run_set()
+	lst := make(RunList, 0, len(r))
+	for _, run := range r {
+		if _, ok := set[run.Number]; !ok {
+			lst = append(lst, run)
+		}
+	}
+	return lst.Dedup()
+}
+
+// Between returns the runs of this RunList taken in [begin, end).
+// A zero begin or end leaves the time window open on that side.
+func (r RunList) Between(begin, end time.Time) RunList {
+	lst := make(RunList, 0, len(r))
+	for _, run := range r {
+		if !begin.IsZero() && run.Time.Before(begin) {
+			continue
+		}
+		if !end.IsZero() && !run.Time.Before(end) {
+			continue
+		}
+		lst = append(lst, run)
+	}
+	return lst
+}
+
+// Nearest returns the run of this RunList taken closest in time to t.
+// Ties are resolved in favour of the earliest run in the list.
+func (r RunList) Nearest(t time.Time) (Run, bool) {
+	best := -1
+	dtmin := time.Duration(0)
+	for i, run := range r {
+		dt := run.Time.Sub(t)
+		if dt < 0 {
+			dt = -dt
+		}
+		if best < 0 || dt < dtmin {
+			best = i
+			dtmin = dt
+		}
+	}
+	if best < 0 {
+		return Run{}, false
+	}
+	return r[best], true
+}
+
+// Period is a calendar period used to group runs.
+type Period int
+
+const (
+	Daily   Period = iota // calendar days
+	Weekly                // ISO weeks, starting on Monday
+	Monthly               // calendar months
+)
+
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "day"
+	case Weekly:
+		return "week"
+	case Monthly:
+		return "month"
+	}
+	return fmt.Sprintf("Period(%d)", int(p))
+}
+
+// start returns the beginning of the period holding t, and its name.
+// It returns false if p is not a valid Period.
+func (p Period) start(t time.Time) (time.Time, string, bool) {
+	y, m, d := t.Date()
+	switch p {
+	case Daily:
+		beg := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		return beg, beg.Format("2006-01-02"), true
+	case Weekly:
+		wd := (int(t.Weekday()) + 6) % 7 // days since Monday
+		beg := time.Date(y, m, d-wd, 0, 0, 0, 0, t.Location())
+		yy, ww := t.ISOWeek()
+		return beg, fmt.Sprintf("%d-W%02d", yy, ww), true
+	case Monthly:
+		beg := time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+		return beg, beg.Format("2006-01"), true
+	}
+	return time.Time{}, "", false
+}
+
+// RunGroup is a group of runs of a RunList.
+type RunGroup struct {
+	Key   string    // name of the group: period (e.g. "2012-05-01", "2012-W18", "2012-05") or run type
+	Begin time.Time // beginning of the period, zero when grouping by run type
+	Runs  RunList
+}
+
+// GroupByPeriod groups the runs of this RunList by calendar period, in the
+// time zone loc (CERN local time if nil).
+// Groups are ordered by time; runs keep their order within a group.
+// It returns nil if p is not one of Daily, Weekly or Monthly.
+func (r RunList) GroupByPeriod(p Period, loc *time.Location) []RunGroup {
+	if _, _, ok := p.start(time.Time{}); !ok {
+		return nil
+	}
+	if loc == nil {
+		loc = CERN
+	}
+	idx := make(map[string]int)
+	groups := make([]RunGroup, 0)
+	for _, run := range r {
+		beg, key, _ := p.start(run.Time.In(loc))
+		i, ok := idx[key]
+		if !ok {
+			i = len(groups)
+			idx[key] = i
+			groups = append(groups, RunGroup{Key: key, Begin: beg})
+		}
+		groups[i].Runs = append(groups[i].Runs, run)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Begin.Before(groups[j].Begin) })
+	return groups
+}
+
+// GroupByType groups the runs of this RunList by run type.
+// Groups are ordered by run type; runs keep their order within a group.
+func (r RunList) GroupByType() []RunGroup {
+	idx := make(map[string]int)
+	groups := make([]RunGroup, 0)
+	for _, run := range r {
+		i, ok := idx[run.Type]
+		if !ok {
+			i = len(groups)
+			idx[run.Type] = i
+			groups = append(groups, RunGroup{Key: run.Type})
+		}
+		groups[i].Runs = append(groups[i].Runs, run)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// ByRunNumber orders runs by run number.
+func ByRunNumber(a, b Run) bool { return a.Number < b.Number }
+
+// ByRunTime orders runs by time.
+func ByRunTime(a, b Run) bool { return a.Time.Before(b.Time) }
+
+// ByRunType orders runs by run type.
+func ByRunType(a, b Run) bool { return a.Type < b.Type }
+
+// SortBy sorts this RunList in place by the given keys: runs are ordered by
+// the first key, then by the second one for runs equal for the first key, and
+// so on. Runs equal for all the keys keep their relative order.
+//
+//	runs.SortBy(tucs.ByRunType, tucs.ByRunTime)
+func (r RunList) SortBy(keys ...func(a, b Run) bool) {
+	sort.SliceStable(r, func(i, j int) bool {
+		for _, less := range keys {
+			switch {
+			case less(r[i], r[j]):
+				return true
+			case less(r[j], r[i]):
+				return false
+			}
+		}
+		return false
+	})
+}
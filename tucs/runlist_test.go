@@ -0,0 +1,331 @@
+package tucs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mkrun(irun int64, rtype string, t time.Time) Run {
+	return Run{Type: rtype, Number: irun, Time: t, Data: make(DataMap)}
+}
+
+func utc(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+}
+
+func numbers(lst RunList) []int64 {
+	if len(lst) == 0 {
+		return nil
+	}
+	return lst.Numbers()
+}
+
+func TestRunListSetOps(t *testing.T) {
+	t0 := utc(2012, time.May, 1, 12, 0)
+	runs := func(iruns ...int64) RunList {
+		lst := make(RunList, 0, len(iruns))
+		for _, irun := range iruns {
+			lst = append(lst, mkrun(irun, "Las", t0))
+		}
+		return lst
+	}
+
+	for _, table := range []struct {
+		name string
+		got  RunList
+		want []int64
+	}{
+		{"dedup", runs(3, 1, 3, 2, 1).Dedup(), []int64{3, 1, 2}},
+		{"dedup-empty", runs().Dedup(), nil},
+		{"union", runs(1, 2, 3).Union(runs(4, 2, 5)), []int64{1, 2, 3, 4, 5}},
+		{"union-dup", runs(1, 1).Union(runs(1)), []int64{1}},
+		{"union-empty", runs().Union(runs(2, 1)), []int64{2, 1}},
+		{"intersect", runs(1, 2, 3, 4).Intersect(runs(4, 2, 6)), []int64{2, 4}},
+		{"intersect-dup", runs(2, 2, 3).Intersect(runs(2)), []int64{2}},
+		{"intersect-none", runs(1, 2).Intersect(runs(3)), nil},
+		{"difference", runs(1, 2, 3, 4).Difference(runs(4, 2, 6)), []int64{1, 3}},
+		{"difference-dup", runs(1, 1, 2).Difference(runs(2)), []int64{1}},
+		{"difference-all", runs(1, 2).Difference(runs(1, 2)), nil},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			if got := numbers(table.got); !reflect.DeepEqual(got, table.want) {
+				t.Fatalf("got %v, want %v", got, table.want)
+			}
+		})
+	}
+}
+
+func TestRunListBetween(t *testing.T) {
+	runs := RunList{
+		mkrun(1, "Las", utc(2012, time.May, 1, 0, 0)),
+		mkrun(2, "Las", utc(2012, time.May, 2, 0, 0)),
+		mkrun(3, "Las", utc(2012, time.May, 3, 0, 0)),
+	}
+
+	for _, table := range []struct {
+		name       string
+		begin, end time.Time
+		want       []int64
+	}{
+		{"open", time.Time{}, time.Time{}, []int64{1, 2, 3}},
+		{"begin-inclusive", utc(2012, time.May, 2, 0, 0), time.Time{}, []int64{2, 3}},
+		{"end-exclusive", time.Time{}, utc(2012, time.May, 2, 0, 0), []int64{1}},
+		{"window", utc(2012, time.May, 1, 12, 0), utc(2012, time.May, 3, 12, 0), []int64{2, 3}},
+		{"empty", utc(2012, time.May, 4, 0, 0), time.Time{}, nil},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			got := numbers(runs.Between(table.begin, table.end))
+			if !reflect.DeepEqual(got, table.want) {
+				t.Fatalf("got %v, want %v", got, table.want)
+			}
+		})
+	}
+}
+
+func TestRunListNearest(t *testing.T) {
+	runs := RunList{
+		mkrun(1, "Las", utc(2012, time.May, 1, 0, 0)),
+		mkrun(2, "Las", utc(2012, time.May, 3, 0, 0)),
+		mkrun(3, "Las", utc(2012, time.May, 5, 0, 0)),
+	}
+
+	for _, table := range []struct {
+		name string
+		runs RunList
+		t    time.Time
+		want int64
+		ok   bool
+	}{
+		{"before", runs, utc(2012, time.April, 1, 0, 0), 1, true},
+		{"after", runs, utc(2012, time.June, 1, 0, 0), 3, true},
+		{"closest", runs, utc(2012, time.May, 3, 20, 0), 2, true},
+		{"exact", runs, utc(2012, time.May, 5, 0, 0), 3, true},
+		{"tie", runs, utc(2012, time.May, 2, 0, 0), 1, true},
+		{"tie-order", RunList{runs[1], runs[0]}, utc(2012, time.May, 2, 0, 0), 2, true},
+		{"empty", nil, utc(2012, time.May, 2, 0, 0), 0, false},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			run, ok := table.runs.Nearest(table.t)
+			if ok != table.ok || run.Number != table.want {
+				t.Fatalf("got (%d, %v), want (%d, %v)", run.Number, ok, table.want, table.ok)
+			}
+		})
+	}
+}
+
+func TestRunListGroupByPeriod(t *testing.T) {
+	type group struct {
+		key   string
+		begin time.Time
+		runs  []int64
+	}
+
+	for _, table := range []struct {
+		name   string
+		period Period
+		loc    *time.Location
+		runs   RunList
+		want   []group
+	}{
+		{
+			name:   "daily",
+			period: Daily,
+			loc:    time.UTC,
+			runs: RunList{
+				mkrun(3, "Las", utc(2012, time.May, 2, 8, 0)),
+				mkrun(1, "Las", utc(2012, time.May, 1, 8, 0)),
+				mkrun(2, "Las", utc(2012, time.May, 1, 23, 59)),
+			},
+			want: []group{
+				{"2012-05-01", utc(2012, time.May, 1, 0, 0), []int64{1, 2}},
+				{"2012-05-02", utc(2012, time.May, 2, 0, 0), []int64{3}},
+			},
+		},
+		{
+			name:   "weekly-year-boundary",
+			period: Weekly,
+			loc:    time.UTC,
+			runs: RunList{
+				mkrun(1, "Las", utc(2012, time.December, 30, 12, 0)), // Sunday
+				mkrun(2, "Las", utc(2012, time.December, 31, 12, 0)), // Monday
+				mkrun(3, "Las", utc(2013, time.January, 1, 12, 0)),
+				mkrun(4, "Las", utc(2013, time.January, 6, 23, 0)),
+			},
+			want: []group{
+				{"2012-W52", utc(2012, time.December, 24, 0, 0), []int64{1}},
+				{"2013-W01", utc(2012, time.December, 31, 0, 0), []int64{2, 3, 4}},
+			},
+		},
+		{
+			name:   "weekly-iso-week-53",
+			period: Weekly,
+			loc:    time.UTC,
+			runs: RunList{
+				mkrun(1, "Las", utc(2010, time.January, 3, 12, 0)), // Sunday
+				mkrun(2, "Las", utc(2010, time.January, 4, 12, 0)), // Monday
+			},
+			want: []group{
+				{"2009-W53", utc(2009, time.December, 28, 0, 0), []int64{1}},
+				{"2010-W01", utc(2010, time.January, 4, 0, 0), []int64{2}},
+			},
+		},
+		{
+			name:   "monthly",
+			period: Monthly,
+			loc:    time.UTC,
+			runs: RunList{
+				mkrun(1, "Las", utc(2012, time.December, 31, 23, 0)),
+				mkrun(2, "Las", utc(2013, time.January, 1, 0, 0)),
+				mkrun(3, "Las", utc(2012, time.December, 1, 0, 0)),
+			},
+			want: []group{
+				{"2012-12", utc(2012, time.December, 1, 0, 0), []int64{1, 3}},
+				{"2013-01", utc(2013, time.January, 1, 0, 0), []int64{2}},
+			},
+		},
+		{
+			name:   "daily-cern-dst-start",
+			period: Daily,
+			loc:    nil, // CERN
+			runs: RunList{
+				mkrun(1, "Las", utc(2012, time.March, 24, 22, 30)), // 23:30 CET
+				mkrun(2, "Las", utc(2012, time.March, 24, 23, 30)), // 00:30 CET
+				mkrun(3, "Las", utc(2012, time.March, 25, 21, 30)), // 23:30 CEST
+				mkrun(4, "Las", utc(2012, time.March, 25, 22, 30)), // 00:30 CEST
+			},
+			want: []group{
+				{"2012-03-24", utc(2012, time.March, 23, 23, 0), []int64{1}},
+				{"2012-03-25", utc(2012, time.March, 24, 23, 0), []int64{2, 3}},
+				{"2012-03-26", utc(2012, time.March, 25, 22, 0), []int64{4}},
+			},
+		},
+		{
+			name:   "daily-cern-dst-end",
+			period: Daily,
+			loc:    CERN,
+			runs: RunList{
+				mkrun(1, "Las", utc(2012, time.October, 27, 21, 30)), // 23:30 CEST
+				mkrun(2, "Las", utc(2012, time.October, 27, 22, 30)), // 00:30 CEST
+				mkrun(3, "Las", utc(2012, time.October, 28, 22, 30)), // 23:30 CET
+				mkrun(4, "Las", utc(2012, time.October, 28, 23, 30)), // 00:30 CET
+			},
+			want: []group{
+				{"2012-10-27", utc(2012, time.October, 26, 22, 0), []int64{1}},
+				{"2012-10-28", utc(2012, time.October, 27, 22, 0), []int64{2, 3}},
+				{"2012-10-29", utc(2012, time.October, 28, 23, 0), []int64{4}},
+			},
+		},
+		{
+			name:   "weekly-cern-dst-end",
+			period: Weekly,
+			loc:    CERN,
+			runs: RunList{
+				mkrun(1, "Las", utc(2012, time.October, 28, 22, 30)), // Sunday 23:30 CET
+				mkrun(2, "Las", utc(2012, time.October, 28, 23, 30)), // Monday 00:30 CET
+			},
+			want: []group{
+				{"2012-W43", utc(2012, time.October, 21, 22, 0), []int64{1}},
+				{"2012-W44", utc(2012, time.October, 28, 23, 0), []int64{2}},
+			},
+		},
+		{
+			name:   "invalid-period",
+			period: Period(42),
+			loc:    time.UTC,
+			runs:   RunList{mkrun(1, "Las", utc(2012, time.May, 1, 0, 0))},
+			want:   nil,
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			groups := table.runs.GroupByPeriod(table.period, table.loc)
+			if len(groups) != len(table.want) {
+				t.Fatalf("got %d groups, want %d: %v", len(groups), len(table.want), groups)
+			}
+			for i, want := range table.want {
+				got := groups[i]
+				if got.Key != want.key {
+					t.Errorf("group %d: got key %q, want %q", i, got.Key, want.key)
+				}
+				if !got.Begin.Equal(want.begin) {
+					t.Errorf("group %q: got begin %v, want %v", got.Key, got.Begin.UTC(), want.begin)
+				}
+				if runs := numbers(got.Runs); !reflect.DeepEqual(runs, want.runs) {
+					t.Errorf("group %q: got runs %v, want %v", got.Key, runs, want.runs)
+				}
+			}
+		})
+	}
+}
+
+func TestRunListGroupByType(t *testing.T) {
+	t0 := utc(2012, time.May, 1, 0, 0)
+	runs := RunList{
+		mkrun(1, "Las", t0),
+		mkrun(2, "CIS", t0),
+		mkrun(3, "Las", t0),
+		mkrun(4, "cesium", t0),
+		mkrun(5, "CIS", t0),
+	}
+
+	groups := runs.GroupByType()
+	want := []struct {
+		key  string
+		runs []int64
+	}{
+		{"CIS", []int64{2, 5}},
+		{"Las", []int64{1, 3}},
+		{"cesium", []int64{4}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, w := range want {
+		if groups[i].Key != w.key {
+			t.Errorf("group %d: got key %q, want %q", i, groups[i].Key, w.key)
+		}
+		if !groups[i].Begin.IsZero() {
+			t.Errorf("group %q: got begin %v, want zero", groups[i].Key, groups[i].Begin)
+		}
+		if got := numbers(groups[i].Runs); !reflect.DeepEqual(got, w.runs) {
+			t.Errorf("group %q: got runs %v, want %v", w.key, got, w.runs)
+		}
+	}
+}
+
+func TestRunListSortBy(t *testing.T) {
+	t1 := utc(2012, time.May, 1, 0, 0)
+	t2 := utc(2012, time.May, 2, 0, 0)
+	runs := func() RunList {
+		return RunList{
+			mkrun(5, "Las", t2),
+			mkrun(2, "CIS", t1),
+			mkrun(4, "Las", t1),
+			mkrun(1, "Las", t2),
+			mkrun(3, "CIS", t2),
+			mkrun(6, "CIS", t1),
+		}
+	}
+
+	for _, table := range []struct {
+		name string
+		keys []func(a, b Run) bool
+		want []int64
+	}{
+		{"none", nil, []int64{5, 2, 4, 1, 3, 6}},
+		{"number", []func(a, b Run) bool{ByRunNumber}, []int64{1, 2, 3, 4, 5, 6}},
+		{"time-stable", []func(a, b Run) bool{ByRunTime}, []int64{2, 4, 6, 5, 1, 3}},
+		{"type-stable", []func(a, b Run) bool{ByRunType}, []int64{2, 3, 6, 5, 4, 1}},
+		{"type-time", []func(a, b Run) bool{ByRunType, ByRunTime}, []int64{2, 6, 3, 4, 5, 1}},
+		{"time-type", []func(a, b Run) bool{ByRunTime, ByRunType}, []int64{2, 6, 4, 3, 5, 1}},
+		{"type-time-number", []func(a, b Run) bool{ByRunType, ByRunTime, ByRunNumber}, []int64{2, 6, 3, 4, 1, 5}},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			lst := runs()
+			lst.SortBy(table.keys...)
+			if got := lst.Numbers(); !reflect.DeepEqual(got, table.want) {
+				t.Fatalf("got %v, want %v", got, table.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package tucs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RunQualityKey is the Run.Data key under which the Filter stores the BadRun
+// entries of a run.
+const RunQualityKey = "quality"
+
+// BadRunReason is the reason why a run is excluded.
+type BadRunReason string
+
+const (
+	LaserMisfire   BadRunReason = "laser-misfire"   // laser did not fire, or fired erratically
+	PartialReadout BadRunReason = "partial-readout" // drawers missing from the readout
+	ShutterProblem BadRunReason = "shutter"         // laser shutter stuck or misreported
+	CorruptedData  BadRunReason = "corrupted"       // corrupted or incomplete data
+	OtherReason    BadRunReason = "other"           // any other reason, see the comment
+)
+
+// bad_run_reasons lists the known reason codes.
+var bad_run_reasons = []BadRunReason{
+	LaserMisfire, PartialReadout, ShutterProblem, CorruptedData, OtherReason,
+}
+
+// ParseBadRunReason returns the BadRunReason named s.
+func ParseBadRunReason(s string) (BadRunReason, error) {
+	s = strings.TrimSpace(s)
+	for _, r := range bad_run_reasons {
+		if strings.EqualFold(string(r), s) {
+			return r, nil
+		}
+	}
+	names := make([]string, len(bad_run_reasons))
+	for i, r := range bad_run_reasons {
+		names[i] = strconv.Quote(string(r))
+	}
+	return "", fmt.Errorf("tucs: unknown bad run reason %q (expected one of %s)", s, strings.Join(names, ", "))
+}
+
+func (r BadRunReason) String() string {
+	return string(r)
+}
+
+// BadRun is an entry of the run quality registry: a run or an inclusive range
+// of runs to exclude, for the whole detector or for some partitions only.
+type BadRun struct {
+	First      int64        // first run number
+	Last       int64        // last run number (== First for a single run)
+	Reason     BadRunReason // reason code
+	Partitions []string     // partitions concerned (e.g. "LBA"), all of them if empty
+	Comment    string       // free-form description
+}
+
+// Contains returns whether run irun is concerned by the entry.
+func (b BadRun) Contains(irun int64) bool {
+	return b.First <= irun && irun <= b.Last
+}
+
+// Covers returns whether partition (e.g. "LBA") is concerned by the entry.
+func (b BadRun) Covers(partition string) bool {
+	if len(b.Partitions) == 0 {
+		return true
+	}
+	for _, p := range b.Partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGlobal returns whether the whole detector is concerned by the entry.
+func (b BadRun) IsGlobal() bool {
+	for _, p := range partition_names {
+		if !b.Covers(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b BadRun) String() string {
+	runs := strconv.FormatInt(b.First, 10)
+	if b.Last != b.First {
+		runs += "-" + strconv.FormatInt(b.Last, 10)
+	}
+	parts := "all partitions"
+	if !b.IsGlobal() {
+		parts = strings.Join(b.Partitions, ",")
+	}
+	s := fmt.Sprintf("run %s: %s (%s)", runs, b.Reason, parts)
+	if b.Comment != "" {
+		s += ": " + b.Comment
+	}
+	return s
+}
+
+// RunQualitySource provides the run quality entries of runs.
+// The RunSources of this package implement it to serve a run quality registry
+// along with the run metadata (see NewMySQLRunSource and OpenCSVRunSource).
+type RunQualitySource interface {
+	// BadRuns returns the entries concerning run irun, if any.
+	BadRuns(irun int64) ([]BadRun, error)
+}
+
+// RunQuality is an in-memory run quality registry.
+type RunQuality struct {
+	entries []BadRun
+}
+
+// NewRunQuality returns a run quality registry holding entries.
+func NewRunQuality(entries ...BadRun) *RunQuality {
+	q := &RunQuality{}
+	for _, e := range entries {
+		q.Add(e)
+	}
+	return q
+}
+
+// LoadRunQuality reads a run quality registry file (see ParseRunQuality).
+func LoadRunQuality(fname string) (*RunQuality, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not open run quality file: %w", err)
+	}
+	defer f.Close()
+	q, err := ParseRunQuality(f)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: invalid run quality file %q: %w", fname, err)
+	}
+	return q, nil
+}
+
+// ParseRunQuality parses a run quality registry: one run or range of runs
+// per line, followed by a reason code and optionally by a comma-separated
+// list of partitions. Everything after a '#' is kept as the comment of the
+// entry, blank lines are ignored:
+//
+//	212345         laser-misfire
+//	212346         partial-readout LBA,EBC  # EBC drawers off
+//	212400-212410  shutter                  # shutter stuck closed
+func ParseRunQuality(r io.Reader) (*RunQuality, error) {
+	q := &RunQuality{}
+	scan := bufio.NewScanner(r)
+	line := 0
+	for scan.Scan() {
+		line++
+		txt := scan.Text()
+		comment := ""
+		if i := strings.Index(txt, "#"); i >= 0 {
+			txt, comment = txt[:i], strings.TrimSpace(txt[i+1:])
+		}
+		fields := strings.Fields(txt)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected run, reason and optional partitions, got %d field(s)", line, len(fields))
+		}
+
+		runs, err := parse_run_range(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry := BadRun{First: runs.First, Last: runs.Last, Comment: comment}
+		entry.Reason, err = ParseBadRunReason(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(fields) > 2 {
+			entry.Partitions, err = parse_partitions(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		q.Add(entry)
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return q, nil
+}
+
+// parse_partitions parses a comma-separated list of partitions (e.g.
+// "LBA,EBC"). An empty list stands for all the partitions.
+func parse_partitions(s string) ([]string, error) {
+	var parts []string
+	if strings.TrimSpace(s) == "" {
+		return parts, nil
+	}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if partition_ros(p) < 0 {
+			return nil, fmt.Errorf("invalid partition %q", p)
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// Add adds an entry to the registry.
+func (q *RunQuality) Add(entry BadRun) {
+	if entry.Last < entry.First {
+		entry.Last = entry.First
+	}
+	entry.Partitions = append([]string(nil), entry.Partitions...)
+	q.entries = append(q.entries, entry)
+}
+
+// Len returns the number of entries of the registry.
+func (q *RunQuality) Len() int {
+	return len(q.entries)
+}
+
+// BadRuns returns the entries concerning run irun, if any.
+func (q *RunQuality) BadRuns(irun int64) ([]BadRun, error) {
+	var bads []BadRun
+	for _, e := range q.entries {
+		if e.Contains(irun) {
+			bads = append(bads, e)
+		}
+	}
+	return bads, nil
+}
+
+// Quality returns the run quality entries the Filter attached to the run.
+func (r Run) Quality() []BadRun {
+	bads, _ := r.Data[RunQualityKey].([]BadRun)
+	return bads
+}
+
+// is_bad_region returns whether region belongs to a partition excluded by one
+// of bads. Regions above the partition level are never excluded.
+func is_bad_region(bads []BadRun, region *Region) (BadRun, bool) {
+	nbr := region.Number(0, 0)
+	if len(nbr) == 0 || nbr[0] < 1 || nbr[0] > len(partition_names) {
+		return BadRun{}, false
+	}
+	return bad_partition(bads, partition_names[nbr[0]-1])
+}
+
+// bad_partition returns the first entry of bads excluding partition, if any.
+func bad_partition(bads []BadRun, partition string) (BadRun, bool) {
+	for _, b := range bads {
+		if b.Covers(partition) {
+			return b, true
+		}
+	}
+	return BadRun{}, false
+}
+
+// DroppedRuns is the global variable holding the runs excluded by the Filter
+// because of their run quality. Their BadRun entries are stored in Run.Data
+// (see Run.Quality).
+var DroppedRuns = make(RunList, 0)
+
+// check RunQuality implements tucs.RunQualitySource
+var _ RunQualitySource = (*RunQuality)(nil)
@@ -0,0 +1,887 @@
+package tucs
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunInfo describes a run as recorded in the tile.comminfo table.
+type RunInfo struct {
+	Number    int64
+	Type      string
+	Date      time.Time
+	EndDate   time.Time // end of the run, zero if unknown
+	Events    int64     // number of events
+	LasFilter string    // laser filter wheel position
+	LasReqAmp float64   // requested laser amplitude
+	LasShOpen bool      // whether the laser shutter was left open
+	RecoFrags string    // fragments sent to reconstruction
+	DigiFrags string    // fragments in readout
+	Comments  string
+}
+
+// RunInfoKey is the Run.Data key under which the Filter stores the RunInfo of
+// the selected runs.
+const RunInfoKey = "info"
+
+// Info returns the RunInfo the Filter attached to the run.
+func (r Run) Info() (RunInfo, bool) {
+	info, ok := r.Data[RunInfoKey].(RunInfo)
+	return info, ok
+}
+
+func (info RunInfo) String() string {
+	return fmt.Sprintf(
+		"RunInfo{Number: %v, Type: %v, Date: %v, Duration: %v, Events: %v, LasFilter: %q, LasReqAmp: %v, LasShOpen: %v, Comments: %q}",
+		info.Number, info.Type, info.Date, info.Duration(), info.Events,
+		info.LasFilter, info.LasReqAmp, info.LasShOpen, info.Comments,
+	)
+}
+
+// Duration returns the duration of the run, or 0 if unknown.
+func (info RunInfo) Duration() time.Duration {
+	if info.EndDate.IsZero() || info.EndDate.Before(info.Date) {
+		return 0
+	}
+	return info.EndDate.Sub(info.Date)
+}
+
+// CsRun describes a cesium scan of a module, as recorded in the
+// tile.runDescr table.
+type CsRun struct {
+	Number    int64
+	Time      time.Time
+	Partition string // "LBA", "LBC", "EBA" or "EBC"
+	Module    int    // module number, from 1 to 64
+	Comment   string // cesium run/magnet description
+}
+
+// RunQuery describes a selection of runs by date.
+type RunQuery struct {
+	Type      RunType     // requested run type (LaserRun, CISRun, CesiumRun or any other type for all runs)
+	Begin     time.Time   // select runs taken after Begin
+	End       time.Time   // select runs taken before End, if not zero
+	Filter    LaserFilter // requested laser filter
+	Amp       float64     // requested laser amplitude
+	CsComment string      // cesium run/magnet description, if not empty
+	Numbers   []int64     // select only these run numbers, if not empty (cesium scans only)
+}
+
+// RunSource gives access to the run metadata the Filter uses to select runs.
+type RunSource interface {
+	// Run returns the description of run number irun.
+	// ok is false if the run is unknown.
+	Run(irun int64) (info RunInfo, ok bool, err error)
+
+	// RunRange returns the descriptions of the known runs numbered from first
+	// to last (inclusive), ordered by run number.
+	RunRange(first, last int64) ([]RunInfo, error)
+
+	// RunDate returns the date of the first run with a number greater or
+	// equal to irun.
+	RunDate(irun int64) (date time.Time, ok bool, err error)
+
+	// Runs returns the numbers of the runs selected by the query q.
+	Runs(q RunQuery) ([]int64, error)
+
+	// DigiFrags returns the list of fragments in readout for run irun.
+	DigiFrags(irun int64) (string, error)
+
+	// CsRuns returns the cesium scans selected by the query q, ordered by time.
+	// A zero q.Begin selects all the scans taken before q.End.
+	CsRuns(q RunQuery) ([]CsRun, error)
+
+	// Close releases the resources held by the RunSource.
+	Close() error
+}
+
+// sql_dialect holds the differences between the SQL databases a RunSource
+// can be backed by.
+type sql_dialect struct {
+	name   string
+	prefix string                        // prefix of table names
+	time   func(t time.Time) interface{} // converts a time into a query argument
+	tables string                        // query counting the tables named ?
+}
+
+var mysql_dialect = sql_dialect{
+	name:   "mysql",
+	prefix: "tile.",
+	time:   func(t time.Time) interface{} { return t },
+	tables: "select count(*) from information_schema.tables where table_schema='tile' and table_name=?",
+}
+
+// sql_dialect_for returns the SQL dialect spoken by a database/sql driver.
+// Only MySQL, the dialect of the ATLAS run database, is supported.
+func sql_dialect_for(driver string) (sql_dialect, error) {
+	switch driver {
+	case "mysql":
+		return mysql_dialect, nil
+	}
+	return sql_dialect{}, fmt.Errorf("tucs: unsupported run database driver %q", driver)
+}
+
+// sqlRunSource is a RunSource backed by a SQL database.
+type sqlRunSource struct {
+	db      *sql.DB
+	dialect sql_dialect
+	shared  bool // whether db is owned by somebody else
+	badruns int  // whether the badruns table exists: 0 if not checked yet, 1 if it does, -1 if not
+}
+
+// NewMySQLRunSource returns a RunSource querying the tile.comminfo and
+// tile.runDescr tables of a MySQL database.
+// It also implements RunQualitySource from the tile.badruns table, if any:
+//
+//	run        first run number of the entry
+//	lastrun    last run number of the entry (NULL for a single run)
+//	reason     reason code (see ParseBadRunReason)
+//	partitions comma-separated partitions concerned (NULL or empty for all)
+//	comment    free-form description (may be NULL)
+//
+// Closing the RunSource closes db.
+func NewMySQLRunSource(db *sql.DB) RunSource {
+	return &sqlRunSource{db: db, dialect: mysql_dialect}
+}
+
+func (src *sqlRunSource) table(name string) string {
+	return src.dialect.prefix + name
+}
+
+// run_columns are the tile.comminfo columns read by scan_run.
+const run_columns = "run, type, date, enddate, events, lasfilter, lasreqamp, lasshopen, recofrags, digifrags, comments"
+
+func (src *sqlRunSource) Run(irun int64) (RunInfo, bool, error) {
+	var info RunInfo
+	rows, err := src.db.Query(
+		`select `+run_columns+` from `+src.table("comminfo")+` where run=?`,
+		irun,
+	)
+	if err != nil {
+		return info, false, fmt.Errorf("tucs: could not query run %d: %w", irun, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return info, false, rows.Err()
+	}
+
+	info, err = scan_run(rows)
+	if err != nil {
+		return info, false, fmt.Errorf("tucs: could not read run %d: %w", irun, err)
+	}
+	return info, true, rows.Err()
+}
+
+func (src *sqlRunSource) RunRange(first, last int64) ([]RunInfo, error) {
+	rows, err := src.db.Query(
+		`select `+run_columns+` from `+src.table("comminfo")+` where run between ? and ? order by run`,
+		first, last,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not query runs %d-%d: %w", first, last, err)
+	}
+	defer rows.Close()
+
+	infos := make([]RunInfo, 0)
+	for rows.Next() {
+		info, err := scan_run(rows)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read runs %d-%d: %w", first, last, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// scan_run reads the run_columns of the current row of rows.
+func scan_run(rows *sql.Rows) (RunInfo, error) {
+	var (
+		info      RunInfo
+		date      db_time
+		enddate   db_time
+		rtype     sql.NullString
+		events    sql.NullInt64
+		lasfilter sql.NullString
+		lasreqamp sql.NullFloat64
+		lasshopen sql.NullInt64
+		recofrags sql.NullString
+		digifrags sql.NullString
+		comments  sql.NullString
+	)
+	err := rows.Scan(
+		&info.Number, &rtype, &date, &enddate, &events, &lasfilter, &lasreqamp,
+		&lasshopen, &recofrags, &digifrags, &comments,
+	)
+	if err != nil {
+		return info, err
+	}
+	info.Type = rtype.String
+	info.Date = date.Time
+	info.EndDate = enddate.Time
+	info.Events = events.Int64
+	info.LasFilter = lasfilter.String
+	info.LasReqAmp = lasreqamp.Float64
+	info.LasShOpen = lasshopen.Int64 == 1
+	info.RecoFrags = recofrags.String
+	info.DigiFrags = digifrags.String
+	info.Comments = comments.String
+	return info, nil
+}
+
+func (src *sqlRunSource) RunDate(irun int64) (time.Time, bool, error) {
+	var date db_time
+	err := src.db.QueryRow(
+		`select date from `+src.table("comminfo")+` where run>=? order by run asc limit 1`,
+		irun,
+	).Scan(&date)
+	switch err {
+	case nil:
+		return date.Time, true, nil
+	case sql.ErrNoRows:
+		return date.Time, false, nil
+	}
+	return date.Time, false, fmt.Errorf("tucs: could not query date of run %d: %w", irun, err)
+}
+
+func (src *sqlRunSource) Runs(q RunQuery) ([]int64, error) {
+	query := []string{}
+	args := []interface{}{}
+
+	switch {
+	case q.Type == LaserRun:
+		query = append(query, "select run from "+src.table("comminfo")+" where")
+		// special treatment for LASER
+		if !q.End.IsZero() {
+			query = append(query, "date>? and date<?")
+			args = append(args, src.dialect.time(q.Begin), src.dialect.time(q.End))
+		} else {
+			query = append(query, "date>?")
+			args = append(args, src.dialect.time(q.Begin))
+		}
+		query = append(query, "and")
+		switch q.Filter {
+		case DefaultLaserFilter:
+			query = append(query, "((lasfilter='6' and events>10000) or (lasfilter='8' and events>100000))")
+		case 6:
+			query = append(query, "(lasfilter='6' and events>10000)")
+		case 8:
+			query = append(query, "(lasfilter='8' and events>100000)")
+		default:
+			query = append(query, "lasfilter=?")
+			args = append(args, q.Filter.String())
+		}
+
+		query = append(query, `and lasreqamp=? and type='Las' and not (recofrags like '%005%' or recofrags like '%50%' or lasshopen=1) and comments is NULL`)
+		args = append(args, q.Amp)
+
+	case q.Type == CesiumRun:
+		query = append(query, "select run from "+src.table("runDescr")+" where time>? and module<65")
+		args = append(args, src.dialect.time(q.Begin))
+		if q.CsComment != "" {
+			query = append(query, "and comment=?")
+			args = append(args, q.CsComment)
+		}
+		if !q.End.IsZero() {
+			query = append(query, "and time<?")
+			args = append(args, src.dialect.time(q.End))
+		}
+
+	case q.Type == CISRun && !q.End.IsZero():
+		query = append(query, "select run from "+src.table("comminfo")+" where date<? and date>?")
+		args = append(args, src.dialect.time(q.End), src.dialect.time(q.Begin))
+
+	default:
+		query = append(query, "select run from "+src.table("comminfo")+" where run<9999999 and date>?")
+		args = append(args, src.dialect.time(q.Begin))
+		if !q.End.IsZero() {
+			query = append(query, "and date<?")
+			args = append(args, src.dialect.time(q.End))
+		}
+	}
+
+	rows, err := src.db.Query(strings.Join(query, " "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not query runs: %w", err)
+	}
+	defer rows.Close()
+
+	iruns := []int64{}
+	for rows.Next() {
+		irun := int64(-1)
+		err = rows.Scan(&irun)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read run number: %w", err)
+		}
+		iruns = append(iruns, irun)
+	}
+	return iruns, rows.Err()
+}
+
+func (src *sqlRunSource) DigiFrags(irun int64) (string, error) {
+	var digifrags sql.NullString
+	err := src.db.QueryRow(
+		`select digifrags from `+src.table("comminfo")+` where run=?`,
+		irun,
+	).Scan(&digifrags)
+	switch err {
+	case nil, sql.ErrNoRows:
+		return digifrags.String, nil
+	}
+	return "", fmt.Errorf("tucs: could not query digifrags of run %d: %w", irun, err)
+}
+
+func (src *sqlRunSource) CsRuns(q RunQuery) ([]CsRun, error) {
+	query := []string{"select run, time, part, module, comment from " + src.table("runDescr") + " where module<65"}
+	args := []interface{}{}
+	if !q.Begin.IsZero() {
+		query = append(query, "and time>?")
+		args = append(args, src.dialect.time(q.Begin))
+	}
+	if !q.End.IsZero() {
+		query = append(query, "and time<?")
+		args = append(args, src.dialect.time(q.End))
+	}
+	if q.CsComment != "" {
+		query = append(query, "and comment=?")
+		args = append(args, q.CsComment)
+	}
+	if len(q.Numbers) > 0 {
+		query = append(query, "and run in (?"+strings.Repeat(",?", len(q.Numbers)-1)+")")
+		for _, irun := range q.Numbers {
+			args = append(args, irun)
+		}
+	}
+	query = append(query, "order by time")
+
+	rows, err := src.db.Query(strings.Join(query, " "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not query cesium runs: %w", err)
+	}
+	defer rows.Close()
+
+	csruns := make([]CsRun, 0)
+	for rows.Next() {
+		var (
+			cs      CsRun
+			date    db_time
+			comment sql.NullString
+		)
+		err = rows.Scan(&cs.Number, &date, &cs.Partition, &cs.Module, &comment)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read cesium run: %w", err)
+		}
+		cs.Time = date.Time
+		cs.Comment = comment.String
+		csruns = append(csruns, cs)
+	}
+	return csruns, rows.Err()
+}
+
+// BadRuns implements RunQualitySource from the badruns table.
+// Databases without a badruns table have no bad runs.
+func (src *sqlRunSource) BadRuns(irun int64) ([]BadRun, error) {
+	if src.badruns == 0 {
+		var n int
+		err := src.db.QueryRow(src.dialect.tables, "badruns").Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not look for the badruns table: %w", err)
+		}
+		src.badruns = -1
+		if n > 0 {
+			src.badruns = 1
+		}
+	}
+	if src.badruns < 0 {
+		return nil, nil
+	}
+
+	rows, err := src.db.Query(
+		`select run, lastrun, reason, partitions, comment from `+src.table("badruns")+
+			` where run<=? and coalesce(lastrun, run)>=? order by run`,
+		irun, irun,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not query run quality of run %d: %w", irun, err)
+	}
+	defer rows.Close()
+
+	var bads []BadRun
+	for rows.Next() {
+		var (
+			bad     BadRun
+			last    sql.NullInt64
+			reason  string
+			parts   sql.NullString
+			comment sql.NullString
+		)
+		err = rows.Scan(&bad.First, &last, &reason, &parts, &comment)
+		if err == nil {
+			bad.Reason, err = ParseBadRunReason(reason)
+		}
+		if err == nil {
+			bad.Partitions, err = parse_partitions(parts.String)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read run quality of run %d: %w", irun, err)
+		}
+		bad.Last = bad.First
+		if last.Valid && last.Int64 > bad.First {
+			bad.Last = last.Int64
+		}
+		bad.Comment = comment.String
+		bads = append(bads, bad)
+	}
+	return bads, rows.Err()
+}
+
+func (src *sqlRunSource) Close() error {
+	if src.shared {
+		return nil
+	}
+	return src.db.Close()
+}
+
+// db_time_layout is the layout of dates stored as strings in run databases.
+const db_time_layout = "2006-01-02 15:04:05"
+
+// db_time is a time.Time which can be scanned from the various forms a date
+// column may take, depending on the SQL driver.
+// Dates stored as strings are in CERN local time.
+type db_time struct {
+	time.Time
+}
+
+func (t *db_time) Scan(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("tucs: cannot scan %T into a date", v)
+}
+
+func (t *db_time) parse(s string) error {
+	var err error
+	for _, layout := range []string{db_time_layout, time.RFC3339Nano, "2006-01-02"} {
+		t.Time, err = time.ParseInLocation(layout, s, CERN)
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("tucs: invalid date %q: %w", s, err)
+}
+
+// MemRunSource is a RunSource holding all the run metadata in memory.
+// It is mostly useful for tests and offline work.
+type MemRunSource struct {
+	infos   []RunInfo // sorted by run number
+	csruns  []CsRun
+	quality RunQuality
+}
+
+// NewMemRunSource returns a RunSource serving the provided runs and cesium
+// scans.
+func NewMemRunSource(infos []RunInfo, csruns []CsRun) *MemRunSource {
+	src := &MemRunSource{
+		infos:  make([]RunInfo, len(infos)),
+		csruns: make([]CsRun, len(csruns)),
+	}
+	copy(src.infos, infos)
+	copy(src.csruns, csruns)
+	sort.SliceStable(src.csruns, func(i, j int) bool { return src.csruns[i].Time.Before(src.csruns[j].Time) })
+	sort.Slice(src.infos, func(i, j int) bool { return src.infos[i].Number < src.infos[j].Number })
+	return src
+}
+
+// AddBadRuns adds entries to the run quality registry of the RunSource.
+func (src *MemRunSource) AddBadRuns(entries ...BadRun) {
+	for _, e := range entries {
+		src.quality.Add(e)
+	}
+}
+
+// OpenCSVRunSource returns a MemRunSource loaded from the CSV files comminfo
+// and, if not empty, csruns and badruns.
+// See ReadRunInfoCSV, ReadCsRunCSV and ReadBadRunCSV for the expected formats.
+func OpenCSVRunSource(comminfo, csruns, badruns string) (*MemRunSource, error) {
+	f, err := os.Open(comminfo)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not open run source: %w", err)
+	}
+	defer f.Close()
+	infos, err := ReadRunInfoCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("tucs: could not read run source %q: %w", comminfo, err)
+	}
+
+	var cs []CsRun
+	if csruns != "" {
+		f, err := os.Open(csruns)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not open run source: %w", err)
+		}
+		defer f.Close()
+		cs, err = ReadCsRunCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read run source %q: %w", csruns, err)
+		}
+	}
+	src := NewMemRunSource(infos, cs)
+
+	if badruns != "" {
+		f, err := os.Open(badruns)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not open run source: %w", err)
+		}
+		defer f.Close()
+		bads, err := ReadBadRunCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: could not read run source %q: %w", badruns, err)
+		}
+		src.AddBadRuns(bads...)
+	}
+	return src, nil
+}
+
+// ReadRunInfoCSV reads run descriptions from a CSV stream.
+// The first record is a header naming the columns, with the same names than
+// the tile.comminfo table: run, type, date, enddate, events, lasfilter,
+// lasreqamp, lasshopen, recofrags, digifrags and comments.
+// Only the run column is mandatory. Dates are "YYYY-MM-DD hh:mm:ss" strings,
+// in CERN local time.
+func ReadRunInfoCSV(r io.Reader) ([]RunInfo, error) {
+	infos := make([]RunInfo, 0)
+	err := read_csv(r, "run", func(rec csv_record) error {
+		var (
+			info RunInfo
+			err  error
+		)
+		info.Number, err = rec.int("run")
+		if err != nil {
+			return err
+		}
+		info.Type = rec.str("type")
+		info.Date, err = rec.time("date")
+		if err != nil {
+			return err
+		}
+		info.EndDate, err = rec.time("enddate")
+		if err != nil {
+			return err
+		}
+		info.Events, err = rec.int("events")
+		if err != nil {
+			return err
+		}
+		info.LasFilter = rec.str("lasfilter")
+		info.LasReqAmp, err = rec.float("lasreqamp")
+		if err != nil {
+			return err
+		}
+		shopen, err := rec.int("lasshopen")
+		if err != nil {
+			return err
+		}
+		info.LasShOpen = shopen == 1
+		info.RecoFrags = rec.str("recofrags")
+		info.DigiFrags = rec.str("digifrags")
+		info.Comments = rec.str("comments")
+		infos = append(infos, info)
+		return nil
+	})
+	return infos, err
+}
+
+// ReadCsRunCSV reads cesium scan descriptions from a CSV stream.
+// The first record is a header naming the columns, with the same names than
+// the tile.runDescr table: run, time, part, module and comment.
+func ReadCsRunCSV(r io.Reader) ([]CsRun, error) {
+	csruns := make([]CsRun, 0)
+	err := read_csv(r, "run", func(rec csv_record) error {
+		var (
+			cs  CsRun
+			err error
+		)
+		cs.Number, err = rec.int("run")
+		if err != nil {
+			return err
+		}
+		cs.Time, err = rec.time("time")
+		if err != nil {
+			return err
+		}
+		mod, err := rec.int("module")
+		if err != nil {
+			return err
+		}
+		cs.Module = int(mod)
+		cs.Partition = rec.str("part")
+		cs.Comment = rec.str("comment")
+		csruns = append(csruns, cs)
+		return nil
+	})
+	return csruns, err
+}
+
+// ReadBadRunCSV reads run quality entries from a CSV stream.
+// The first record is a header naming the columns, with the same names than
+// the tile.badruns table (see NewMySQLRunSource): run, lastrun, reason,
+// partitions and comment. The partitions are comma-separated, hence quoted:
+//
+//	run,lastrun,reason,partitions,comment
+//	212345,,laser-misfire,,
+//	212346,,partial-readout,"LBA,EBC",EBC drawers off
+//	212400,212410,shutter,,shutter stuck closed
+func ReadBadRunCSV(r io.Reader) ([]BadRun, error) {
+	bads := make([]BadRun, 0)
+	err := read_csv(r, "run", func(rec csv_record) error {
+		var (
+			bad BadRun
+			err error
+		)
+		bad.First, err = rec.int("run")
+		if err != nil {
+			return err
+		}
+		if bad.First <= 0 {
+			return fmt.Errorf("invalid run value %q", rec.str("run"))
+		}
+		bad.Last, err = rec.int("lastrun")
+		if err != nil {
+			return err
+		}
+		if bad.Last < bad.First {
+			bad.Last = bad.First
+		}
+		bad.Reason, err = ParseBadRunReason(rec.str("reason"))
+		if err != nil {
+			return err
+		}
+		bad.Partitions, err = parse_partitions(rec.str("partitions"))
+		if err != nil {
+			return err
+		}
+		bad.Comment = rec.str("comment")
+		bads = append(bads, bad)
+		return nil
+	})
+	return bads, err
+}
+
+// csv_record is a CSV record with named columns.
+type csv_record struct {
+	cols   map[string]int
+	fields []string
+}
+
+func (rec csv_record) str(name string) string {
+	i, ok := rec.cols[name]
+	if !ok || i >= len(rec.fields) {
+		return ""
+	}
+	return strings.TrimSpace(rec.fields[i])
+}
+
+func (rec csv_record) int(name string) (int64, error) {
+	s := rec.str(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", name, s)
+	}
+	return v, nil
+}
+
+func (rec csv_record) float(name string) (float64, error) {
+	s := rec.str(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", name, s)
+	}
+	return v, nil
+}
+
+func (rec csv_record) time(name string) (time.Time, error) {
+	var t db_time
+	s := rec.str(name)
+	if s == "" {
+		return t.Time, nil
+	}
+	err := t.parse(s)
+	return t.Time, err
+}
+
+// read_csv reads a CSV stream with a header and calls fct for each record.
+func read_csv(r io.Reader, required string, fct func(rec csv_record) error) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("could not read CSV header: %w", err)
+	}
+	rec := csv_record{cols: make(map[string]int, len(header))}
+	for i, name := range header {
+		rec.cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := rec.cols[required]; !ok {
+		return fmt.Errorf("missing %q column in CSV header", required)
+	}
+
+	for {
+		rec.fields, err = cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		err = fct(rec)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func (src *MemRunSource) Run(irun int64) (RunInfo, bool, error) {
+	i := sort.Search(len(src.infos), func(i int) bool { return src.infos[i].Number >= irun })
+	if i < len(src.infos) && src.infos[i].Number == irun {
+		return src.infos[i], true, nil
+	}
+	return RunInfo{}, false, nil
+}
+
+func (src *MemRunSource) RunRange(first, last int64) ([]RunInfo, error) {
+	infos := make([]RunInfo, 0)
+	i := sort.Search(len(src.infos), func(i int) bool { return src.infos[i].Number >= first })
+	for ; i < len(src.infos) && src.infos[i].Number <= last; i++ {
+		infos = append(infos, src.infos[i])
+	}
+	return infos, nil
+}
+
+func (src *MemRunSource) RunDate(irun int64) (time.Time, bool, error) {
+	i := sort.Search(len(src.infos), func(i int) bool { return src.infos[i].Number >= irun })
+	if i < len(src.infos) {
+		return src.infos[i].Date, true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+func (src *MemRunSource) Runs(q RunQuery) ([]int64, error) {
+	iruns := []int64{}
+
+	if q.Type == CesiumRun {
+		for _, cs := range src.csruns {
+			if cs.Time.After(q.Begin) && cs.Module < 65 &&
+				(q.CsComment == "" || cs.Comment == q.CsComment) &&
+				(q.End.IsZero() || cs.Time.Before(q.End)) {
+				iruns = append(iruns, cs.Number)
+			}
+		}
+		return iruns, nil
+	}
+
+	for _, info := range src.infos {
+		if !info.Date.After(q.Begin) {
+			continue
+		}
+		switch {
+		case q.Type == LaserRun:
+			if !q.End.IsZero() && !info.Date.Before(q.End) {
+				continue
+			}
+			if !mem_laser_filter(q.Filter, info) {
+				continue
+			}
+			if info.LasReqAmp != q.Amp || info.Type != string(LaserRun) ||
+				strings.Contains(info.RecoFrags, "005") ||
+				strings.Contains(info.RecoFrags, "50") ||
+				info.LasShOpen || info.Comments != "" {
+				continue
+			}
+		case q.Type == CISRun && !q.End.IsZero():
+			if !info.Date.Before(q.End) {
+				continue
+			}
+		default:
+			if info.Number >= 9999999 ||
+				(!q.End.IsZero() && !info.Date.Before(q.End)) {
+				continue
+			}
+		}
+		iruns = append(iruns, info.Number)
+	}
+	return iruns, nil
+}
+
+// mem_laser_filter mimics the laser filter selection of sqlRunSource.Runs
+func mem_laser_filter(filter LaserFilter, info RunInfo) bool {
+	switch filter {
+	case DefaultLaserFilter:
+		return (info.LasFilter == "6" && info.Events > 10000) ||
+			(info.LasFilter == "8" && info.Events > 100000)
+	case 6:
+		return info.LasFilter == "6" && info.Events > 10000
+	case 8:
+		return info.LasFilter == "8" && info.Events > 100000
+	}
+	return info.LasFilter == filter.String()
+}
+
+func (src *MemRunSource) DigiFrags(irun int64) (string, error) {
+	info, _, err := src.Run(irun)
+	return info.DigiFrags, err
+}
+
+func (src *MemRunSource) CsRuns(q RunQuery) ([]CsRun, error) {
+	csruns := make([]CsRun, 0)
+	for _, cs := range src.csruns {
+		if cs.Module >= 65 ||
+			(!q.Begin.IsZero() && !cs.Time.After(q.Begin)) ||
+			(!q.End.IsZero() && !cs.Time.Before(q.End)) ||
+			(q.CsComment != "" && cs.Comment != q.CsComment) ||
+			(len(q.Numbers) > 0 && !in_int64slice(cs.Number, q.Numbers)) {
+			continue
+		}
+		csruns = append(csruns, cs)
+	}
+	return csruns, nil
+}
+
+func (src *MemRunSource) BadRuns(irun int64) ([]BadRun, error) {
+	return src.quality.BadRuns(irun)
+}
+
+func (src *MemRunSource) Close() error {
+	return nil
+}
+
+// check sqlRunSource and MemRunSource implement tucs.RunSource and
+// tucs.RunQualitySource
+var _ RunSource = (*sqlRunSource)(nil)
+var _ RunSource = (*MemRunSource)(nil)
+var _ RunQualitySource = (*sqlRunSource)(nil)
+var _ RunQualitySource = (*MemRunSource)(nil)
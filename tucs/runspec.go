@@ -0,0 +1,291 @@
+package tucs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunType is a type of calibration run, as recorded in the run database.
+type RunType string
+
+const (
+	LaserRun    RunType = "Las"     // laser runs
+	CISRun      RunType = "CIS"     // charge injection runs
+	MonoCISRun  RunType = "MonoCIS" // mono-amplitude charge injection runs
+	PedestalRun RunType = "Ped"     // pedestal runs
+	PhysicsRun  RunType = "Phys"    // physics runs
+	LEDRun      RunType = "LED"     // LED runs
+	CesiumRun   RunType = "cesium"  // cesium scans (from the cesium run database)
+	AllRuns     RunType = "all"     // runs of any type
+)
+
+// run_types lists the known run types.
+var run_types = []RunType{
+	LaserRun, CISRun, MonoCISRun, PedestalRun, PhysicsRun, LEDRun, CesiumRun, AllRuns,
+}
+
+// ParseRunType returns the RunType named s.
+// Names are case-sensitive, as in the run database.
+func ParseRunType(s string) (RunType, error) {
+	s = strings.TrimSpace(s)
+	for _, rt := range run_types {
+		if string(rt) == s {
+			return rt, nil
+		}
+	}
+	for _, rt := range run_types {
+		if strings.EqualFold(string(rt), s) {
+			return "", fmt.Errorf("tucs: unknown run type %q (did you mean %q?)", s, rt)
+		}
+	}
+	names := make([]string, len(run_types))
+	for i, rt := range run_types {
+		names[i] = strconv.Quote(string(rt))
+	}
+	return "", fmt.Errorf("tucs: unknown run type %q (expected one of %s)", s, strings.Join(names, ", "))
+}
+
+// IsValid returns whether rt is a known run type.
+func (rt RunType) IsValid() bool {
+	_, err := ParseRunType(string(rt))
+	return err == nil
+}
+
+func (rt RunType) String() string {
+	return string(rt)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (rt RunType) MarshalText() ([]byte, error) {
+	return []byte(rt), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so misspelled run types
+// are rejected when loading a configuration.
+func (rt *RunType) UnmarshalText(b []byte) error {
+	v, err := ParseRunType(string(b))
+	if err != nil {
+		return err
+	}
+	*rt = v
+	return nil
+}
+
+// LaserFilter is the position (1 to 8) of the laser filter wheel.
+// The zero value selects the usual filters 6 and 8.
+type LaserFilter int
+
+// DefaultLaserFilter selects the usual laser filters 6 and 8.
+const DefaultLaserFilter LaserFilter = 0
+
+// ParseLaserFilter returns the LaserFilter described by s: "1" to "8", or ""
+// for DefaultLaserFilter.
+func ParseLaserFilter(s string) (LaserFilter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultLaserFilter, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 || v > 8 {
+		return DefaultLaserFilter, fmt.Errorf("tucs: invalid laser filter %q (expected 1 to 8)", s)
+	}
+	return LaserFilter(v), nil
+}
+
+// IsValid returns whether f is a filter wheel position or DefaultLaserFilter.
+func (f LaserFilter) IsValid() bool {
+	return 0 <= f && f <= 8
+}
+
+// String returns the filter wheel position as recorded in the run database,
+// or "" for DefaultLaserFilter.
+func (f LaserFilter) String() string {
+	if f == DefaultLaserFilter {
+		return ""
+	}
+	return strconv.Itoa(int(f))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (f LaserFilter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *LaserFilter) UnmarshalText(b []byte) error {
+	v, err := ParseLaserFilter(string(b))
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// run_spec_kind is the kind of a RunSpec.
+type run_spec_kind int
+
+const (
+	run_spec_none    run_spec_kind = iota
+	run_spec_numbers               // explicit run numbers
+	run_spec_file                  // run list file
+	run_spec_since                 // runs taken since a date
+	run_spec_between               // runs taken between 2 dates
+)
+
+// RunSpec specifies the runs a Filter selects.
+// RunSpecs are created with SingleRun, RunNumbers, RunFile, RunsSince and
+// RunsBetween, or parsed from their text form with ParseRunSpec.
+type RunSpec struct {
+	kind  run_spec_kind
+	runs  []int64 // run numbers
+	file  string  // run list file
+	begin string  // date expression of the beginning of the period
+	end   string  // date expression of the end of the period
+}
+
+// SingleRun selects run irun.
+func SingleRun(irun int64) RunSpec {
+	return RunNumbers(irun)
+}
+
+// RunNumbers selects the runs iruns.
+func RunNumbers(iruns ...int64) RunSpec {
+	return RunSpec{kind: run_spec_numbers, runs: append([]int64(nil), iruns...)}
+}
+
+// RunFile selects the runs listed in the file fname (see ReadRunFile).
+func RunFile(fname string) RunSpec {
+	return RunSpec{kind: run_spec_file, file: fname}
+}
+
+// RunsSince selects the runs taken since the date expression date, relative
+// ("-1 week") or absolute ("2012-05-01"). See ParseDate.
+func RunsSince(date string) RunSpec {
+	return RunSpec{kind: run_spec_since, begin: date}
+}
+
+// RunsBetween selects the runs taken between the date expressions begin and
+// end, e.g. RunsBetween("2012-05-01 -28 days", "2012-05-01"). See ParseDate.
+func RunsBetween(begin, end string) RunSpec {
+	return RunSpec{kind: run_spec_between, begin: begin, end: end}
+}
+
+// IsZero returns whether no run was specified.
+func (spec RunSpec) IsZero() bool {
+	return spec.kind == run_spec_none
+}
+
+// ByDate returns whether the runs are selected by date.
+func (spec RunSpec) ByDate() bool {
+	return spec.kind == run_spec_since || spec.kind == run_spec_between
+}
+
+func (spec RunSpec) String() string {
+	switch spec.kind {
+	case run_spec_numbers:
+		return fmt.Sprintf("runs %v", spec.runs)
+	case run_spec_file:
+		return fmt.Sprintf("runs from file %q", spec.file)
+	case run_spec_since:
+		return fmt.Sprintf("runs since %q", spec.begin)
+	case run_spec_between:
+		return fmt.Sprintf("runs between %q and %q", spec.begin, spec.end)
+	}
+	return "no runs"
+}
+
+// ParseRunSpec returns the RunSpec described by s:
+//   - "212000" or "212000,212005": run numbers (see RunNumbers),
+//   - "file:runs.txt": the runs listed in a file (see RunFile),
+//   - "since:-1 week": the runs taken since a date (see RunsSince),
+//   - "between:2012-05-01 -28 days..2012-05-01": the runs taken between 2
+//     dates (see RunsBetween).
+//
+// Date expressions are checked with ParseDate.
+func ParseRunSpec(s string) (RunSpec, error) {
+	s = strings.TrimSpace(s)
+	bad := func(format string, args ...interface{}) (RunSpec, error) {
+		return RunSpec{}, fmt.Errorf("tucs: invalid run specification %q: %s",
+			s, fmt.Sprintf(format, args...))
+	}
+	check_date := func(date string) error {
+		_, err := ParseDate(date, time.Now(), nil)
+		return err
+	}
+
+	kind, arg := "", s
+	if i := strings.Index(s, ":"); i >= 0 {
+		kind, arg = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	switch kind {
+	case "":
+		if arg == "" {
+			return bad("no run specified")
+		}
+		var iruns []int64
+		for _, v := range strings.Split(arg, ",") {
+			irun, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil || irun <= 0 {
+				return bad("invalid run number %q", v)
+			}
+			iruns = append(iruns, irun)
+		}
+		return RunNumbers(iruns...), nil
+	case "file":
+		if arg == "" {
+			return bad("no file name")
+		}
+		return RunFile(arg), nil
+	case "since":
+		if err := check_date(arg); err != nil {
+			return bad("%v", err)
+		}
+		return RunsSince(arg), nil
+	case "between":
+		dates := strings.Split(arg, "..")
+		if len(dates) != 2 {
+			return bad("expected 2 dates separated by '..'")
+		}
+		for i := range dates {
+			dates[i] = strings.TrimSpace(dates[i])
+			if err := check_date(dates[i]); err != nil {
+				return bad("%v", err)
+			}
+		}
+		return RunsBetween(dates[0], dates[1]), nil
+	}
+	return bad("unknown kind %q (expected file, since or between)", kind)
+}
+
+// MarshalText implements encoding.TextMarshaler, with the text form read by
+// ParseRunSpec.
+func (spec RunSpec) MarshalText() ([]byte, error) {
+	switch spec.kind {
+	case run_spec_numbers:
+		nums := make([]string, len(spec.runs))
+		for i, irun := range spec.runs {
+			nums[i] = strconv.FormatInt(irun, 10)
+		}
+		return []byte(strings.Join(nums, ",")), nil
+	case run_spec_file:
+		return []byte("file:" + spec.file), nil
+	case run_spec_since:
+		return []byte("since:" + spec.begin), nil
+	case run_spec_between:
+		return []byte("between:" + spec.begin + ".." + spec.end), nil
+	}
+	return nil, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so run specifications
+// can be loaded from a configuration file (see ParseRunSpec).
+func (spec *RunSpec) UnmarshalText(b []byte) error {
+	v, err := ParseRunSpec(string(b))
+	if err != nil {
+		return err
+	}
+	*spec = v
+	return nil
+}
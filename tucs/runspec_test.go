@@ -0,0 +1,93 @@
+package tucs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseRunSpec(t *testing.T) {
+	for _, table := range []struct {
+		text string
+		want RunSpec
+	}{
+		{"212000", SingleRun(212000)},
+		{"212000, 212005,212010", RunNumbers(212000, 212005, 212010)},
+		{"file:runs.txt", RunFile("runs.txt")},
+		{"file: /data/runs 2012.json", RunFile("/data/runs 2012.json")},
+		{"since:-1 week", RunsSince("-1 week")},
+		{"since:2012-05-01 14:30", RunsSince("2012-05-01 14:30")},
+		{"between:2012-05-01 -28 days..2012-05-01", RunsBetween("2012-05-01 -28 days", "2012-05-01")},
+	} {
+		t.Run(table.text, func(t *testing.T) {
+			got, err := ParseRunSpec(table.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, table.want) {
+				t.Fatalf("got %v, want %v", got, table.want)
+			}
+
+			txt, err := got.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var spec RunSpec
+			err = spec.UnmarshalText(txt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spec, table.want) {
+				t.Fatalf("round trip: got %v, want %v", spec, table.want)
+			}
+		})
+	}
+}
+
+func TestParseRunSpecErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"212000,",
+		"-212000",
+		"212000-212100",
+		"file:",
+		"since:a week",
+		"since:",
+		"between:2012-05-01",
+		"between:2012-05-01..2012-06-01..2012-07-01",
+		"between:2012-05-01..next parsec",
+		"runs:212000",
+	} {
+		t.Run(text, func(t *testing.T) {
+			spec, err := ParseRunSpec(text)
+			if err == nil {
+				t.Fatalf("expected an error, got %v", spec)
+			}
+		})
+	}
+}
+
+func TestFilterCfgJSON(t *testing.T) {
+	var cfg FilterCfg
+	err := json.Unmarshal([]byte(`{"Runs": "since:-1 week", "RunType": "Las", "Filter": "6", "Amp": 23}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := RunsSince("-1 week"); !reflect.DeepEqual(cfg.Runs, want) {
+		t.Fatalf("got runs %v, want %v", cfg.Runs, want)
+	}
+	if cfg.RunType != LaserRun || cfg.Filter != 6 {
+		t.Fatalf("got run type %q and filter %v, want %q and 6", cfg.RunType, cfg.Filter, LaserRun)
+	}
+
+	for _, doc := range []string{
+		`{"Runs": "since:-1 weak", "RunType": "Las"}`,
+		`{"Runs": "212000", "RunType": "Laser"}`,
+		`{"Runs": "212000", "Filter": "9"}`,
+	} {
+		err = json.Unmarshal([]byte(doc), &FilterCfg{})
+		if err == nil {
+			t.Fatalf("%s: expected an error", doc)
+		}
+	}
+}
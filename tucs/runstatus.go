@@ -0,0 +1,251 @@
+package tucs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RunStatusKey is the Run.Data key under which the RunStatus of a run is
+// stored by the RunStatus worker.
+const RunStatusKey = "status"
+
+// partition_names lists the TileCal partitions, indexed by ROS number - 1.
+var partition_names = [4]string{"LBA", "LBC", "EBA", "EBC"}
+
+// Partitions returns the names of the TileCal partitions, indexed by ROS
+// number - 1.
+func Partitions() [4]string {
+	return partition_names
+}
+
+var digifrag_re = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+
+// RunStatus is the set of drawers in readout during a run, as decoded from
+// the list of fragments (digifrags) recorded in the run database.
+//
+// A fragment id 0xRRMM designates the drawer of ROS RR (1=LBA, 2=LBC, 3=EBA,
+// 4=EBC) and module MM+1.
+type RunStatus struct {
+	Run     int64
+	known   bool        // whether the list of fragments was available
+	drawers [4][64]bool // drawers in readout, indexed by ROS-1 and module-1
+}
+
+// ParseDigiFrags decodes the list of fragments in readout for run irun.
+// An empty list carries no information: all the drawers are then considered
+// to be in readout. Fragments which are not TileCal drawers are ignored.
+func ParseDigiFrags(irun int64, digifrags string) (*RunStatus, error) {
+	st := &RunStatus{Run: irun}
+	if strings.TrimSpace(digifrags) == "" {
+		return st, nil
+	}
+	st.known = true
+	for _, frag := range digifrag_re.FindAllString(digifrags, -1) {
+		id, err := strconv.ParseUint(frag[2:], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("tucs: run %d: invalid fragment %q: %w", irun, frag, err)
+		}
+		ros := int(id>>8) - 1
+		mod := int(id & 0xff)
+		if ros < 0 || ros >= len(st.drawers) || mod >= len(st.drawers[ros]) {
+			continue
+		}
+		st.drawers[ros][mod] = true
+	}
+	return st, nil
+}
+
+// Known returns whether the list of fragments in readout was available.
+func (st *RunStatus) Known() bool {
+	return st.known
+}
+
+// IsModuleActive returns whether module (1-64) of partition (e.g. "LBA") was
+// in readout.
+func (st *RunStatus) IsModuleActive(partition string, module int) bool {
+	if !st.known {
+		return true
+	}
+	ros := partition_ros(partition)
+	if ros < 0 || module < 1 || module > 64 {
+		return false
+	}
+	return st.drawers[ros][module-1]
+}
+
+// ActiveModules returns the modules (1-64) of partition (e.g. "LBA") which
+// were in readout.
+func (st *RunStatus) ActiveModules(partition string) []int {
+	mods := make([]int, 0, 64)
+	for mod := 1; mod <= 64; mod++ {
+		if st.IsModuleActive(partition, mod) {
+			mods = append(mods, mod)
+		}
+	}
+	return mods
+}
+
+// NumActive returns the number of drawers in readout.
+func (st *RunStatus) NumActive() int {
+	n := 0
+	for _, part := range partition_names {
+		n += len(st.ActiveModules(part))
+	}
+	return n
+}
+
+// IsActive returns whether region was in readout.
+// Regions above the module level (TILECAL, partitions) are active when at
+// least one of their drawers was in readout.
+func (st *RunStatus) IsActive(region *Region) bool {
+	if !st.known {
+		return true
+	}
+	nbr := region.Number(0, 0)
+	switch len(nbr) {
+	case 0:
+		return st.NumActive() > 0
+	case 1:
+		if nbr[0] < 1 || nbr[0] > len(partition_names) {
+			return false
+		}
+		return len(st.ActiveModules(partition_names[nbr[0]-1])) > 0
+	default:
+		if nbr[0] < 1 || nbr[0] > len(partition_names) {
+			return false
+		}
+		return st.IsModuleActive(partition_names[nbr[0]-1], nbr[1])
+	}
+}
+
+func (st *RunStatus) String() string {
+	if !st.known {
+		return fmt.Sprintf("run %d: no readout information", st.Run)
+	}
+	parts := make([]string, 0, len(partition_names))
+	for _, part := range partition_names {
+		parts = append(parts, fmt.Sprintf("%s=%d", part, len(st.ActiveModules(part))))
+	}
+	return fmt.Sprintf("run %d: %d drawer(s) in readout (%s)",
+		st.Run, st.NumActive(), strings.Join(parts, ", "))
+}
+
+// Status returns the RunStatus attached to the run by the RunStatus worker.
+func (r Run) Status() (*RunStatus, bool) {
+	st, ok := r.Data[RunStatusKey].(*RunStatus)
+	return st, ok
+}
+
+func partition_ros(partition string) int {
+	for i, name := range partition_names {
+		if name == partition {
+			return i
+		}
+	}
+	return -1
+}
+
+// RunStatusCfg is a helper struct to ease the configuration of NewRunStatus
+type RunStatusCfg struct {
+	Source       RunSource // source of run metadata. nil: run database described by DB
+	DB           DBConfig  // run database, used when Source is nil. see DBConfig.Resolve
+	DropInactive bool      // remove the events of the regions not in readout
+	Verbose      bool      // enable verbose output
+}
+
+// runStatusWorker attaches the RunStatus of each run to Run.Data
+type runStatusWorker struct {
+	Base
+	sourceHolder
+	drop     bool
+	verbose  bool
+	statuses map[int64]*RunStatus
+}
+
+// NewRunStatus returns a worker decoding the drawers in readout for each run
+// selected by the Filter, and storing it as a *RunStatus under RunStatusKey in
+// Run.Data, so downstream workers can skip dead drawers (see Run.Status).
+// It must be run after the Filter.
+func NewRunStatus(rtype RegionType, cfg RunStatusCfg) (Worker, error) {
+	w := &runStatusWorker{
+		Base:     NewBase(rtype),
+		drop:     cfg.DropInactive,
+		verbose:  cfg.Verbose,
+		statuses: make(map[int64]*RunStatus),
+	}
+	err := w.init_source(cfg.Source, cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("tucs.RunStatus: %w", err)
+	}
+	return w, nil
+}
+
+func (w *runStatusWorker) ProcessStart() error {
+	err := w.open_source()
+	if err != nil {
+		return fmt.Errorf("tucs.RunStatus: %w", err)
+	}
+	w.statuses = make(map[int64]*RunStatus)
+	for _, run := range Runs {
+		_, err = w.status(run)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *runStatusWorker) ProcessStop() error {
+	return w.close_source()
+}
+
+func (w *runStatusWorker) ProcessRegion(region *Region) error {
+	events := region.Events()
+	keep := events[:0]
+	for _, evt := range events {
+		st, err := w.status(evt.Run)
+		if err != nil {
+			return err
+		}
+		if w.drop && !st.IsActive(region) {
+			if w.verbose {
+				fmt.Printf("tucs.RunStatus: run %d: region not in readout, removing: %v\n",
+					evt.Run.Number, region.Hash(0, 0))
+			}
+			continue
+		}
+		keep = append(keep, evt)
+	}
+	region.SetEvents(keep)
+	return nil
+}
+
+// status returns the RunStatus of run, fetching it if needed and attaching it
+// to run.Data.
+func (w *runStatusWorker) status(run Run) (*RunStatus, error) {
+	st, ok := w.statuses[run.Number]
+	if !ok {
+		digifrags, err := w.src.DigiFrags(run.Number)
+		if err != nil {
+			return nil, fmt.Errorf("tucs.RunStatus: %w", err)
+		}
+		st, err = ParseDigiFrags(run.Number, digifrags)
+		if err != nil {
+			return nil, err
+		}
+		w.statuses[run.Number] = st
+		if w.verbose {
+			fmt.Printf("tucs.RunStatus: %v\n", st)
+		}
+	}
+	if run.Data != nil {
+		run.Data[RunStatusKey] = st
+	}
+	return st, nil
+}
+
+// check runStatusWorker implements tucs.Worker and tucs.appWorker
+var _ Worker = (*runStatusWorker)(nil)
+var _ appWorker = (*runStatusWorker)(nil)
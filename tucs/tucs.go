@@ -1,6 +1,7 @@
 package tucs
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"strconv"
@@ -18,6 +19,13 @@ type Worker interface {
 type App struct {
 	workers  []Worker
 	detector *Region
+	dbs      map[DBConfig]*sql.DB // connection pools shared by the workers
+}
+
+// appWorker is implemented by workers which need resources owned by the App.
+type appWorker interface {
+	// setup is called by App.Run before ProcessStart.
+	setup(app *App) error
 }
 
 // NewApp creates a new tucs application
@@ -25,6 +33,7 @@ func NewApp(useMBTS, useSpecialEBmods bool) *App {
 	app := &App{
 		workers:  []Worker{},
 		detector: nil,
+		dbs:      make(map[DBConfig]*sql.DB),
 	}
 	app.msg("Welcome to Go-TUCS (pid=%d). Building detector tree...\n", os.Getpid())
 	app.detector = TileCal(useMBTS, useSpecialEBmods)
@@ -38,11 +47,19 @@ func (app *App) msg(format string, args ...interface{}) {
 
 func (app *App) Run() error {
 	var err error
+	defer app.close_dbs()
 
 	msg := fmt.Printf
 	for _, w := range app.workers {
 
 		msg("running [%T]...\n", w)
+		if w, ok := w.(appWorker); ok {
+			err = w.setup(app)
+			if err != nil {
+				return err
+			}
+		}
+
 		err = w.ProcessStart()
 		if err != nil {
 			return err
@@ -53,6 +70,9 @@ func (app *App) Run() error {
 			func(t RegionType, region *Region) error {
 				return w.ProcessRegion(region)
 			})
+		if err != nil {
+			return err
+		}
 
 		err = w.ProcessStop()
 		if err != nil {
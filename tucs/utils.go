@@ -1,7 +1,9 @@
 package tucs
 
 import (
+	"fmt"
 	"os"
+	"strings"
 )
 
 func in_intslice(val int, slice []int) bool {
@@ -13,6 +15,15 @@ func in_intslice(val int, slice []int) bool {
 	return false
 }
 
+func in_int64slice(val int64, slice []int64) bool {
+	for _, v := range slice {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
 // idx_intslice returns the index in slice of the first element equal to val
 func idx_intslice(val int, slice []int) int {
 	for i, v := range slice {
@@ -34,3 +45,35 @@ func PathExists(name string) bool {
 	}
 	return false
 }
+
+func in_strslice(val string, slice []string) bool {
+	for _, v := range slice {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigError reports all the problems found in the configuration of a worker.
+type ConfigError struct {
+	Worker string   // name of the worker
+	Errs   []string // list of problems
+}
+
+// Add records a problem with the configuration field field.
+func (e *ConfigError) Add(field, format string, args ...interface{}) {
+	e.Errs = append(e.Errs, field+": "+fmt.Sprintf(format, args...))
+}
+
+// Err returns nil if no problem was recorded, e otherwise.
+func (e *ConfigError) Err() error {
+	if len(e.Errs) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: invalid configuration:\n\t%s", e.Worker, strings.Join(e.Errs, "\n\t"))
+}
@@ -0,0 +1,280 @@
+package tucs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MappingProblem is an inconsistency found in the mapping of a detector tree.
+type MappingProblem struct {
+	Check string // name of the failed check
+	Hash  string // hash of the offending region
+	Msg   string
+}
+
+func (p MappingProblem) String() string {
+	return fmt.Sprintf("[%s] %s: %s", p.Check, p.Hash, p.Msg)
+}
+
+// MappingReport is the result of the validation of a TileCal detector tree.
+type MappingReport struct {
+	UseMBTS          bool
+	UseSpecialEBmods bool
+	Channels         int // number of PMT-bearing channels checked
+	Cells            int // number of cells checked
+	Problems         []MappingProblem
+}
+
+// OK returns whether no problem was found.
+func (r *MappingReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns a non-nil error describing all the problems found, if any.
+func (r *MappingReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	msgs := make([]string, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		msgs = append(msgs, p.String())
+	}
+	return fmt.Errorf("tucs: invalid detector mapping (mbts=%v, special-eb=%v):\n%s",
+		r.UseMBTS, r.UseSpecialEBmods, strings.Join(msgs, "\n"))
+}
+
+// Print dumps the report into the out io.Writer
+func (r *MappingReport) Print(out io.Writer) {
+	fmt.Fprintf(out, "TileCal mapping (mbts=%v, special-eb=%v): %d channel(s), %d cell(s), %d problem(s)\n",
+		r.UseMBTS, r.UseSpecialEBmods, r.Channels, r.Cells, len(r.Problems))
+	for _, p := range r.Problems {
+		fmt.Fprintf(out, "** %s\n", p)
+	}
+}
+
+func (r *MappingReport) add(check string, region *Region, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, MappingProblem{
+		Check: check,
+		Hash:  region.Hash(0, 0),
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateTileCal checks the consistency of the detector tree built by TileCal
+// with the same mapping options.
+//
+// It checks that:
+//   - parent and child links are reciprocal,
+//   - every PMT-bearing channel is read out by exactly one cell of its own
+//     module, except for the LBC D0 channel (read out by the D0 cell drawn on
+//     the A-side) and for the E4' channel of modules sharing their crack
+//     scintillator with a MBTS module,
+//   - every cell holds the expected number of channels (1 for E cells and
+//     MBTS, 2 otherwise),
+//   - MBTS modules and crack partners are symmetric.
+func ValidateTileCal(tilecal *Region, useMBTS, useSpecialEBmods bool) *MappingReport {
+	report := &MappingReport{
+		UseMBTS:          useMBTS,
+		UseSpecialEBmods: useSpecialEBmods,
+		Problems:         make([]MappingProblem, 0),
+	}
+
+	tilecal.IterRegions(Physical, func(t RegionType, region *Region) error {
+		validate_links(report, region)
+		return nil
+	})
+
+	for _, partition := range tilecal.Children(Readout) {
+		pname := partition.Name(0)
+		for _, module := range partition.Children(Readout) {
+			for _, channel := range module.Children(Readout) {
+				if channel.Type != Readout {
+					continue
+				}
+				report.Channels++
+				validate_channel(report, pname, module, channel, useMBTS)
+			}
+			for _, sample := range module.Children(Physical) {
+				if sample.Type != Physical {
+					continue
+				}
+				for _, cell := range sample.Children(Physical) {
+					report.Cells++
+					validate_cell(report, cell)
+				}
+			}
+			if pname == "EBA" || pname == "EBC" {
+				validate_crack(report, partition, module, useMBTS)
+			}
+		}
+	}
+	return report
+}
+
+// validate_links checks parent/child reciprocity, as Region.SanityCheck does.
+func validate_links(report *MappingReport, region *Region) {
+	for _, p := range region.parents {
+		found := false
+		for _, c := range p.children {
+			if c == region {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report.add("links", region, "not a child of its parent %q", p.Hash(0, 0))
+		}
+	}
+	for _, c := range region.children {
+		found := false
+		for _, p := range c.parents {
+			if p == region {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report.add("links", region, "not a parent of its child %q", c.Hash(0, 0))
+		}
+	}
+}
+
+func validate_channel(report *MappingReport, pname string, module, channel *Region, useMBTS bool) {
+	cells := make([]*Region, 0, 1)
+	for _, p := range channel.parents {
+		if p.Type == Physical {
+			cells = append(cells, p)
+		}
+	}
+	if len(cells) != 1 {
+		names := make([]string, 0, len(cells))
+		for _, c := range cells {
+			names = append(names, c.Hash(0, 0))
+		}
+		report.add("channel-cell", channel, "read out by %d cell(s) %v (expected 1)", len(cells), names)
+		return
+	}
+
+	cell := cells[0]
+	cmod := cell.Parent(Physical, 0).Parent(Readout, 0)
+	if cmod == module {
+		return
+	}
+
+	// documented exceptions
+	chname := channel.Name(0)
+	switch {
+	case pname == "LBC" && chname == "c00":
+		if cmod.Name(0) == module.Name(0) && cmod.Parent(Readout, 0).Name(0) == "LBA" &&
+			strings.HasSuffix(cell.Hash(0, 0), "_sD_t00") {
+			return
+		}
+	case useMBTS && chname == "c01" && module.MBTSType() == 1:
+		if cmod.Name(0) == module.CrackPartner() &&
+			cmod.Parent(Readout, 0) == module.Parent(Readout, 0) &&
+			strings.HasSuffix(cell.Hash(0, 0), "_sE_t15") {
+			return
+		}
+	}
+	report.add("channel-cell", channel, "read out by cell %q of another module", cell.Hash(0, 0))
+}
+
+func validate_cell(report *MappingReport, cell *Region) {
+	want := 2
+	if cell.Parent(Physical, 0).Name(0) == "sE" {
+		want = 1
+	}
+
+	chans := 0
+	for _, c := range cell.children {
+		if c.Type != Readout || !has_parent(c, Readout) {
+			report.add("cell-channels", cell, "child %q is not a readout channel of a module", c.Hash(0, 0))
+			continue
+		}
+		chans++
+	}
+	if chans != want {
+		report.add("cell-channels", cell, "holds %d channel(s) (expected %d)", chans, want)
+	}
+}
+
+// has_parent returns whether region has a parent of type rtype.
+// (Region.Parent falls back on the first parent of any type.)
+func has_parent(region *Region, rtype RegionType) bool {
+	for _, p := range region.parents {
+		if p.Type == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+// mbts_counters lists the MBTS counters, by their L1 trigger names, read out
+// by the E sample of the extended barrel modules, indexed by partition and
+// module number.
+var mbts_counters = map[string]map[int]string{
+	"EBA": {
+		4: "A0", 13: "A1", 24: "A2", 31: "A3", 36: "A4", 44: "A5", 53: "A6", 61: "A7",
+		3: "A8", 12: "A9", 23: "A10", 30: "A11", 35: "A12", 45: "A13", 54: "A14", 60: "A15",
+	},
+	"EBC": {
+		5: "C0", 13: "C1", 20: "C2", 28: "C3", 37: "C4", 45: "C5", 55: "C6", 62: "C7",
+		4: "C8", 12: "C9", 19: "C10", 27: "C11", 36: "C12", 44: "C13", 54: "C14", 61: "C15",
+	},
+}
+
+func validate_crack(report *MappingReport, partition, module *Region, useMBTS bool) {
+	mbts := module.MBTSType()
+	partner := module.CrackPartner()
+	if mbts == 0 {
+		if partner != "" {
+			report.add("crack", module, "no MBTS but crack partner %q", partner)
+		}
+		return
+	}
+
+	var pmod *Region
+	for _, m := range partition.Children(Readout) {
+		if m.Name(0) == partner {
+			pmod = m
+			break
+		}
+	}
+	if pmod == nil {
+		report.add("crack", module, "no crack partner module (%q)", partner)
+		return
+	}
+	if pmod.CrackPartner() != module.Name(0) {
+		report.add("crack", module, "crack partner %q is paired with %q",
+			partner, pmod.CrackPartner())
+	}
+	if pmbts := pmod.MBTSType(); pmbts+mbts != 3 {
+		report.add("mbts", module, "MBTS type %d but crack partner %q has MBTS type %d",
+			mbts, partner, pmbts)
+	}
+
+	if !useMBTS {
+		return
+	}
+
+	counter, ok := mbts_counters[partition.Name(0)][module.Number(0, 0)[1]]
+	if !ok {
+		report.add("mbts", module, "MBTS type %d but no MBTS counter", mbts)
+	}
+	nmbts := 0
+	for _, sample := range module.Children(Physical) {
+		for _, cell := range sample.Children(Physical) {
+			if strings.HasPrefix(cell.Name(0), "MBTS") {
+				nmbts++
+				if ok && cell.Name(0) != "MBTS"+counter {
+					report.add("mbts", cell, "unexpected MBTS name (expected %q)",
+						"MBTS"+counter)
+				}
+			}
+		}
+	}
+	if nmbts != 1 {
+		report.add("mbts", module, "holds %d MBTS counter(s) (expected 1)", nmbts)
+	}
+}
@@ -0,0 +1,99 @@
+package tucs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidateTileCal(t *testing.T) {
+	for _, useMBTS := range []bool{false, true} {
+		for _, useSpecialEBmods := range []bool{false, true} {
+			name := fmt.Sprintf("mbts=%v-special=%v", useMBTS, useSpecialEBmods)
+			t.Run(name, func(t *testing.T) {
+				tilecal := TileCal(useMBTS, useSpecialEBmods)
+				report := ValidateTileCal(tilecal, useMBTS, useSpecialEBmods)
+				if !report.OK() {
+					t.Fatal(report.Err())
+				}
+			})
+		}
+	}
+}
+
+func TestValidateTileCalProblems(t *testing.T) {
+	find := func(tilecal *Region, match func(region *Region) bool) *Region {
+		var found *Region
+		tilecal.IterRegions(Physical, func(t RegionType, region *Region) error {
+			if found == nil && match(region) {
+				found = region
+			}
+			return nil
+		})
+		return found
+	}
+
+	for _, table := range []struct {
+		name    string
+		corrupt func(tilecal *Region) *Region // returns the region expected in the report
+		check   string
+	}{
+		{
+			name: "mbts-name",
+			corrupt: func(tilecal *Region) *Region {
+				cell := find(tilecal, func(r *Region) bool { return r.Name(0) == "MBTSA0" })
+				cell.names[0] = "MBTSA8"
+				return cell
+			},
+			check: "mbts",
+		},
+		{
+			name: "cell-channel-without-module",
+			corrupt: func(tilecal *Region) *Region {
+				cell := find(tilecal, func(r *Region) bool {
+					return r.Type == Physical && len(r.children) == 2 && r.children[0].Type == Readout
+				})
+				channel := cell.children[0]
+				parents := channel.parents[:0]
+				for _, p := range channel.parents {
+					if p.Type != Readout {
+						parents = append(parents, p)
+					}
+				}
+				channel.parents = parents
+				return cell
+			},
+			check: "cell-channels",
+		},
+		{
+			name: "channel-without-cell",
+			corrupt: func(tilecal *Region) *Region {
+				cell := find(tilecal, func(r *Region) bool {
+					return r.Type == Physical && len(r.children) == 2 && r.children[0].Type == Readout
+				})
+				channel := cell.children[0]
+				cell.children = cell.children[1:]
+				parents := channel.parents[:0]
+				for _, p := range channel.parents {
+					if p != cell {
+						parents = append(parents, p)
+					}
+				}
+				channel.parents = parents
+				return channel
+			},
+			check: "channel-cell",
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			tilecal := TileCal(true, false)
+			region := table.corrupt(tilecal)
+			report := ValidateTileCal(tilecal, true, false)
+			for _, p := range report.Problems {
+				if p.Check == table.check && p.Hash == region.Hash(0, 0) {
+					return
+				}
+			}
+			t.Fatalf("no %q problem for %q in:\n%v", table.check, region.Hash(0, 0), report.Err())
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cesium
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MagnetState is the state of a magnet during a cesium scan
+type MagnetState int
+
+const (
+	MagnetUnknown MagnetState = iota // not given by the scan description
+	MagnetOn
+	MagnetOff
+)
+
+func (m MagnetState) String() string {
+	switch m {
+	case MagnetOn:
+		return "on"
+	case MagnetOff:
+		return "off"
+	}
+	return "unknown"
+}
+
+// Conditions are the source and magnet conditions of a cesium scan, as given
+// by its description (CsRun.Comment)
+type Conditions struct {
+	Source   string      // cesium source (e.g. "1"), "" if not given
+	Solenoid MagnetState // state of the solenoid
+	Toroid   MagnetState // state of the toroids
+}
+
+var (
+	cs_source_re   = regexp.MustCompile(`(?:source|src)\s*#?\s*(\d+)|\bcs(\d)\b`)
+	cs_solenoid_re = regexp.MustCompile(`solenoid\s*(on|off)`)
+	cs_toroid_re   = regexp.MustCompile(`toroids?\s*(on|off)`)
+	cs_magnets_re  = regexp.MustCompile(`(?:magnets?|b-?field)\s*(on|off)`)
+)
+
+// ParseConditions extracts the source and magnet conditions from the
+// description of a cesium scan, e.g. "source 2, solenoid on, toroid off" or
+// "Cs1 magnets off". Missing conditions are left unknown.
+func ParseConditions(comment string) Conditions {
+	var c Conditions
+	s := strings.ToLower(comment)
+	if m := cs_source_re.FindStringSubmatch(s); m != nil {
+		c.Source = m[1] + m[2]
+	}
+	if m := cs_magnets_re.FindStringSubmatch(s); m != nil {
+		c.Solenoid = magnet_state(m[1])
+		c.Toroid = c.Solenoid
+	}
+	if m := cs_solenoid_re.FindStringSubmatch(s); m != nil {
+		c.Solenoid = magnet_state(m[1])
+	}
+	if m := cs_toroid_re.FindStringSubmatch(s); m != nil {
+		c.Toroid = magnet_state(m[1])
+	}
+	return c
+}
+
+func magnet_state(s string) MagnetState {
+	if s == "on" {
+		return MagnetOn
+	}
+	return MagnetOff
+}
@@ -0,0 +1,23 @@
+package cesium
+
+import "testing"
+
+func TestParseConditions(t *testing.T) {
+	for _, table := range []struct {
+		comment string
+		want    Conditions
+	}{
+		{"", Conditions{}},
+		{"source 2, solenoid on, toroid off", Conditions{"2", MagnetOn, MagnetOff}},
+		{"Cs1 magnets off", Conditions{"1", MagnetOff, MagnetOff}},
+		{"src #3 B-field on, toroids off", Conditions{"3", MagnetOn, MagnetOff}},
+		{"Solenoid OFF", Conditions{"", MagnetOff, MagnetUnknown}},
+		{"weekly scan", Conditions{}},
+	} {
+		t.Run(table.comment, func(t *testing.T) {
+			if got := ParseConditions(table.comment); got != table.want {
+				t.Fatalf("got %+v, want %+v", got, table.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package cesium
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+const (
+	// cs_tree is the name of the tree of the cesium scan files
+	cs_tree = "cs"
+
+	// nchans is the number of channels of a module
+	nchans = 48
+)
+
+// cs_key identifies the cesium scan of a module
+type cs_key struct {
+	scan   int64
+	ros    int // 1=LBA, 2=LBC, 3=EBA, 4=EBC
+	module int
+}
+
+func (k cs_key) fname() string {
+	return fmt.Sprintf("tileCalibCs_%d_%s_m%02d.root", k.scan, tucs.Partitions()[k.ros-1], k.module)
+}
+
+// cs_data holds the results of the cesium scan of a module
+type cs_data struct {
+	response     [nchans]float64 // cesium response of each channel
+	response_err [nchans]float64 // uncertainty of the cesium response
+	int_gain     [nchans]float64 // integrator gain of each channel
+}
+
+// readcesium is a tucs.Worker to read cesium scan results
+type readcesium struct {
+	tucs.CalibBase
+	data    map[cs_key]*cs_data // nil for scans without results
+	verbose bool
+}
+
+type ReadCesiumCfg struct {
+	WorkDir string // name of the directory holding data
+	Verbose bool
+}
+
+// ReadCesium returns a worker reading the cesium scan results of each module
+// from the tileCalibCs_<scan>_<partition>_m<module>.root files, for the scans
+// selected by the Filter (with the CesiumRun run type).
+//
+// It stores on the events of the channel regions the cesium response of the
+// channel ("response" and "response_err"), the mean response of the channels
+// of its cell ("cell_response"), its integrator gain ("int_gain") and the
+// source and magnet conditions of the scan ("conditions", see
+// ParseConditions). The events of the scans without results are dropped.
+func ReadCesium(rtype tucs.RegionType, cfg ReadCesiumCfg) tucs.Worker {
+	w := &readcesium{
+		CalibBase: tucs.NewCalibBase(rtype, cfg.WorkDir),
+		data:      make(map[cs_key]*cs_data),
+		verbose:   cfg.Verbose,
+	}
+	return w
+}
+
+func (w *readcesium) ProcessStart() error {
+	w.data = make(map[cs_key]*cs_data)
+	return nil
+}
+
+func (w *readcesium) ProcessStop() error {
+	w.data = make(map[cs_key]*cs_data)
+	return w.CloseFiles()
+}
+
+// scan returns the results of the cesium scan of a module, reading them if
+// needed.
+func (w *readcesium) scan(key cs_key) *cs_data {
+	data, ok := w.data[key]
+	if ok {
+		return data
+	}
+	w.data[key] = nil
+
+	fname := key.fname()
+	if !tucs.PathExists(path.Join(w.Dir(), fname)) {
+		if w.verbose {
+			fmt.Printf("cesium.ReadCesium: no file %v\n", fname)
+		}
+		return nil
+	}
+	vals, err := w.ReadEntry(fname, cs_tree, 0, "response", "response_err", "int_gain")
+	if err == nil && (len(vals["response"]) != nchans || len(vals["int_gain"]) != nchans) {
+		err = fmt.Errorf("missing or invalid response and int_gain branches in %q", fname)
+	}
+	if err != nil {
+		fmt.Printf("**warning** cesium.ReadCesium: %v\n", err)
+		return nil
+	}
+
+	data = &cs_data{}
+	copy(data.response[:], vals["response"])
+	copy(data.response_err[:], vals["response_err"])
+	copy(data.int_gain[:], vals["int_gain"])
+	w.data[key] = data
+	if w.verbose {
+		fmt.Printf("file: %v\n", fname)
+	}
+	return data
+}
+
+// cell_response returns the mean cesium response of the channels of the cell
+// of channel, for scan.
+func (w *readcesium) cell_response(channel *tucs.Region, scan int64) (float64, bool) {
+	cell := channel.Parent(tucs.Physical, 0)
+	if cell == nil || cell.Type != tucs.Physical {
+		return 0, false
+	}
+	sum := 0.0
+	n := 0
+	for _, ch := range cell.Children(tucs.Readout) {
+		nbr := ch.Number(0, 0)
+		if ch.Type != tucs.Readout || len(nbr) != 3 {
+			continue
+		}
+		data := w.scan(cs_key{scan, nbr[0], nbr[1]})
+		if data == nil || data.response[nbr[2]] <= 0 {
+			continue
+		}
+		sum += data.response[nbr[2]]
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+func (w *readcesium) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 3 {
+		// cesium scans are per channel
+		return nil
+	}
+	ch := nbr[2]
+
+	events := region.Events()
+	keep := events[:0]
+	for _, evt := range events {
+		if evt.Run.Type != string(tucs.CesiumRun) {
+			keep = append(keep, evt)
+			continue
+		}
+		data := w.scan(cs_key{evt.Run.Number, nbr[0], nbr[1]})
+		if data == nil {
+			if w.verbose {
+				fmt.Printf("no cesium scan results for scan %d, removing: %v\n",
+					evt.Run.Number, region.Hash(0, 0))
+			}
+			continue
+		}
+		evt.Data["response"] = data.response[ch]
+		evt.Data["response_err"] = data.response_err[ch]
+		evt.Data["int_gain"] = data.int_gain[ch]
+		if resp, ok := w.cell_response(region, evt.Run.Number); ok {
+			evt.Data["cell_response"] = resp
+		}
+		comment, _ := evt.Data["cs_comment"].(string)
+		evt.Data["conditions"] = ParseConditions(comment)
+		keep = append(keep, evt)
+	}
+	region.SetEvents(keep)
+	return nil
+}
+
+// check readcesium implements the tucs.Worker interface
+var _ tucs.Worker = (*readcesium)(nil)
@@ -0,0 +1,126 @@
+package cesium
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+// write_scan writes the cesium scan file fname, whose single entry holds the
+// values pointed at by vars.
+func write_scan(t *testing.T, fname string, vars []rtree.WriteVar) {
+	t.Helper()
+	f, err := groot.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tree, err := rtree.NewWriter(f, cs_tree, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tree.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCesium(t *testing.T) {
+	dir := t.TempDir()
+	var response, response_err, int_gain [nchans]float32
+	for ch := range response {
+		response[ch] = float32(ch + 1)
+		response_err[ch] = 0.5
+		int_gain[ch] = 2
+	}
+	write_scan(t, filepath.Join(dir, "tileCalibCs_5001_LBA_m01.root"), []rtree.WriteVar{
+		{Name: "response", Value: &response},
+		{Name: "response_err", Value: &response_err},
+		{Name: "int_gain", Value: &int_gain},
+	})
+
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	scan := tucs.Run{Type: string(tucs.CesiumRun), Number: 5001, Time: t0, Data: make(tucs.DataMap)}
+	laser := tucs.Run{Type: string(tucs.LaserRun), Number: 200001, Time: t0, Data: make(tucs.DataMap)}
+
+	channels := make(map[string]*tucs.Region)
+	tilecal := tucs.TileCal(false, false)
+	tilecal.IterRegions(tucs.Readout, func(_ tucs.RegionType, region *tucs.Region) error {
+		if len(region.Number(0, 0)) == 3 {
+			channels[region.Hash(0, 0)] = region
+		}
+		return nil
+	})
+	hashes := []string{"TILECAL_LBA_m01_c00", "TILECAL_LBA_m01_c01", "TILECAL_LBA_m02_c00"}
+	for _, hash := range hashes {
+		channels[hash].AddEvent(tucs.Event{Run: scan, Data: tucs.DataMap{"cs_comment": "source 2, solenoid on, toroid off"}})
+		channels[hash].AddEvent(tucs.Event{Run: laser, Data: make(tucs.DataMap)})
+	}
+
+	w := ReadCesium(tucs.Readout, ReadCesiumCfg{WorkDir: dir})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range hashes {
+		err = w.ProcessRegion(channels[hash])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.ProcessStop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []struct {
+		hash     string
+		response float64
+		cell     float64
+	}{
+		// the LBC channel of the D0 cell has no scan
+		{"TILECAL_LBA_m01_c00", 1, 1},
+		// the A1 cell is read by c01 and c04
+		{"TILECAL_LBA_m01_c01", 2, 3.5},
+	} {
+		evts := channels[table.hash].Events()
+		if len(evts) != 2 {
+			t.Fatalf("%s: got %d events, want 2", table.hash, len(evts))
+		}
+		data := evts[0].Data
+		if got := data["response"].(float64); got != table.response {
+			t.Fatalf("%s: got response %v, want %v", table.hash, got, table.response)
+		}
+		if got := data["cell_response"].(float64); got != table.cell {
+			t.Fatalf("%s: got cell response %v, want %v", table.hash, got, table.cell)
+		}
+		if got := data["int_gain"].(float64); got != 2 {
+			t.Fatalf("%s: got integrator gain %v, want 2", table.hash, got)
+		}
+		want := Conditions{Source: "2", Solenoid: MagnetOn, Toroid: MagnetOff}
+		if got := data["conditions"].(Conditions); got != want {
+			t.Fatalf("%s: got conditions %+v, want %+v", table.hash, got, want)
+		}
+		if _, ok := evts[1].Data["response"]; ok {
+			t.Fatalf("%s: laser event got a cesium response", table.hash)
+		}
+	}
+
+	// no scan results for LBA_m02
+	evts := channels["TILECAL_LBA_m02_c00"].Events()
+	if len(evts) != 1 || evts[0].Run.Number != laser.Number {
+		t.Fatalf("got events %v, want the laser event only", evts)
+	}
+}
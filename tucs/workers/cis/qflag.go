@@ -0,0 +1,64 @@
+package cis
+
+import (
+	"strings"
+)
+
+// QFlag is the quality flag of the CIS calibration of an ADC: each bit is set
+// when the corresponding check passed
+type QFlag int
+
+const (
+	MaxPointOK      QFlag = 1 << iota // maximum response within the expected range
+	LikelyCalibOK                     // calibration close to the nominal one
+	NoDigitalErrors                   // no digital errors during the run
+	ProbabilityOK                     // linear fit probability above threshold
+	ResponseOK                        // the ADC responds to the charge injection
+	InjectionRMSOK                    // RMS of the injected charges below threshold
+	NoStuckBit                        // no stuck bit in the ADC samples
+
+	// AllOK is the quality flag of an ADC passing all the checks
+	AllOK = MaxPointOK | LikelyCalibOK | NoDigitalErrors | ProbabilityOK | ResponseOK | InjectionRMSOK | NoStuckBit
+)
+
+var qflag_names = []struct {
+	bit  QFlag
+	name string
+}{
+	{MaxPointOK, "max-point"},
+	{LikelyCalibOK, "likely-calib"},
+	{NoDigitalErrors, "digital-errors"},
+	{ProbabilityOK, "probability"},
+	{ResponseOK, "response"},
+	{InjectionRMSOK, "injection-rms"},
+	{NoStuckBit, "stuck-bit"},
+}
+
+// Good returns whether all the checks passed
+func (q QFlag) Good() bool {
+	return q&AllOK == AllOK
+}
+
+// Linear returns whether the response of the ADC is linear: the linear fit is
+// good and the ADC does not saturate
+func (q QFlag) Linear() bool {
+	return q&(ProbabilityOK|MaxPointOK) == ProbabilityOK|MaxPointOK
+}
+
+// Failed returns the names of the failed checks
+func (q QFlag) Failed() []string {
+	var failed []string
+	for _, v := range qflag_names {
+		if q&v.bit == 0 {
+			failed = append(failed, v.name)
+		}
+	}
+	return failed
+}
+
+func (q QFlag) String() string {
+	if q.Good() {
+		return "ok"
+	}
+	return "failed: " + strings.Join(q.Failed(), ",")
+}
@@ -0,0 +1,30 @@
+package cis
+
+import "testing"
+
+func TestQFlag(t *testing.T) {
+	for _, table := range []struct {
+		qflag  QFlag
+		good   bool
+		linear bool
+		str    string
+	}{
+		{AllOK, true, true, "ok"},
+		{AllOK &^ ResponseOK, false, true, "failed: response"},
+		{AllOK &^ ProbabilityOK, false, false, "failed: probability"},
+		{AllOK &^ (MaxPointOK | NoStuckBit), false, false, "failed: max-point,stuck-bit"},
+		{0, false, false, "failed: max-point,likely-calib,digital-errors,probability,response,injection-rms,stuck-bit"},
+	} {
+		t.Run(table.str, func(t *testing.T) {
+			if got := table.qflag.Good(); got != table.good {
+				t.Fatalf("got good=%v, want %v", got, table.good)
+			}
+			if got := table.qflag.Linear(); got != table.linear {
+				t.Fatalf("got linear=%v, want %v", got, table.linear)
+			}
+			if got := table.qflag.String(); got != table.str {
+				t.Fatalf("got %q, want %q", got, table.str)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package cis
+
+import (
+	"fmt"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// cis_tree is the name of the tree of the CIS ntuples
+const cis_tree = "h3000"
+
+// cis_data holds the per-ADC CIS calibration of a run
+type cis_data struct {
+	calib tucs.ADCArray // calibration constant (ADC counts/pC)
+	qflag tucs.ADCArray // quality flag
+	chi2  tucs.ADCArray // chi2 of the linear fit
+}
+
+// readcis is a tucs.Worker to read CIS calibration data
+type readcis struct {
+	tucs.CalibBase
+	data    map[int64]*cis_data
+	verbose bool
+}
+
+type ReadCISCfg struct {
+	WorkDir string // name of the directory holding data
+	Verbose bool
+}
+
+// ReadCIS returns a worker reading the CIS calibration of each ADC from the
+// CIS ntuples of the runs selected by the Filter.
+//
+// It stores on the events of the gain regions the pC to ADC counts
+// calibration constant ("calibration"), the chi2 of the linear fit ("chi2"),
+// the quality flag ("qflag", see QFlag) and whether all the checks passed
+// ("good") and the response is linear ("linear").
+func ReadCIS(rtype tucs.RegionType, cfg ReadCISCfg) tucs.Worker {
+	w := &readcis{
+		CalibBase: tucs.NewCalibBase(rtype, cfg.WorkDir),
+		data:      make(map[int64]*cis_data),
+		verbose:   cfg.Verbose,
+	}
+	return w
+}
+
+func (w *readcis) ProcessStart() error {
+	w.data = make(map[int64]*cis_data)
+	w.ReadRuns("cis.ReadCIS", tucs.CISRun,
+		func(run tucs.Run) string {
+			return fmt.Sprintf("tileCalibCIS_%v_CIS.0.root", run.Number)
+		},
+		func(run tucs.Run, fname string) error {
+			data, err := w.read(fname)
+			if err != nil {
+				return err
+			}
+			w.data[run.Number] = data
+			return nil
+		},
+	)
+	return nil
+}
+
+func (w *readcis) ProcessStop() error {
+	return w.CloseFiles()
+}
+
+// read reads the per-ADC CIS calibration of the CIS ntuple fname
+func (w *readcis) read(fname string) (*cis_data, error) {
+	branches := []string{"calib", "qflag", "chi2"}
+	vals, err := w.ReadEntry(fname, cis_tree, 0, branches...)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &cis_data{}
+	for name, dst := range map[string]*tucs.ADCArray{
+		"calib": &data.calib,
+		"qflag": &data.qflag,
+		"chi2":  &data.chi2,
+	} {
+		err = dst.Set(vals[name])
+		if err != nil {
+			return nil, fmt.Errorf("branch %q of %q holds %w", name, fname, err)
+		}
+	}
+	return data, nil
+}
+
+func (w *readcis) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 4 {
+		// CIS calibration is per ADC
+		return nil
+	}
+
+	for _, evt := range region.Events() {
+		data, ok := w.data[evt.Run.Number]
+		if evt.Run.Type != string(tucs.CISRun) || !ok {
+			continue
+		}
+		qflag := QFlag(data.qflag.At(nbr))
+		evt.Data["calibration"] = data.calib.At(nbr)
+		evt.Data["chi2"] = data.chi2.At(nbr)
+		evt.Data["qflag"] = qflag
+		evt.Data["good"] = qflag.Good()
+		evt.Data["linear"] = qflag.Linear()
+		if w.verbose && !qflag.Good() {
+			fmt.Printf("run %d: CIS %v for: %v\n", evt.Run.Number, qflag, region.Hash(0, 0))
+		}
+	}
+	return nil
+}
+
+// check readcis implements the tucs.Worker interface
+var _ tucs.Worker = (*readcis)(nil)
@@ -0,0 +1,125 @@
+package cis
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+// cis_array holds a value per ADC, as stored in the CIS ntuples (with an
+// unused ROS 0)
+type cis_array [5][64][48][2]float32
+
+// write_ntuple writes the CIS ntuple fname, whose single entry holds the
+// values pointed at by vars.
+func write_ntuple(t *testing.T, fname string, vars []rtree.WriteVar) {
+	t.Helper()
+	f, err := groot.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tree, err := rtree.NewWriter(f, cis_tree, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tree.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// adcs returns the ADC regions of tilecal, by hash
+func adcs(tilecal *tucs.Region) map[string]*tucs.Region {
+	regions := make(map[string]*tucs.Region)
+	tilecal.IterRegions(tucs.Readout, func(t tucs.RegionType, region *tucs.Region) error {
+		if len(region.Number(0, 0)) == 4 {
+			regions[region.Hash(0, 0)] = region
+		}
+		return nil
+	})
+	return regions
+}
+
+func TestReadCIS(t *testing.T) {
+	dir := t.TempDir()
+	var calib, qflag, chi2 cis_array
+	for ros := 1; ros < len(calib); ros++ {
+		for mod := range calib[ros] {
+			for ch := range calib[ros][mod] {
+				calib[ros][mod][ch] = [2]float32{1.29, 81.8}
+				qflag[ros][mod][ch] = [2]float32{float32(AllOK), float32(AllOK)}
+				chi2[ros][mod][ch] = [2]float32{1, 1}
+			}
+		}
+	}
+	// EBC_m64_c02_highgain
+	calib[4][63][2][1] = 80
+	qflag[4][63][2][1] = float32(AllOK &^ ProbabilityOK)
+	write_ntuple(t, filepath.Join(dir, "tileCalibCIS_200004_CIS.0.root"), []rtree.WriteVar{
+		{Name: "calib", Value: &calib},
+		{Name: "qflag", Value: &qflag},
+		{Name: "chi2", Value: &chi2},
+	})
+
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	run := tucs.Run{Type: string(tucs.CISRun), Number: 200004, Time: t0, Data: make(tucs.DataMap)}
+	tucs.Runs = tucs.RunList{
+		run,
+		{Type: string(tucs.CISRun), Number: 200005, Time: t0, Data: make(tucs.DataMap)}, // no ntuple
+	}
+
+	w := ReadCIS(tucs.Readout, ReadCISCfg{WorkDir: dir})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+	if len(tucs.Runs) != 1 || tucs.Runs[0].Number != run.Number {
+		t.Fatalf("got runs %v, want [%d]", tucs.Runs, run.Number)
+	}
+
+	regions := adcs(tucs.TileCal(false, false))
+	for _, table := range []struct {
+		hash   string
+		calib  float64
+		good   bool
+		linear bool
+	}{
+		{"TILECAL_LBA_m01_c00_lowgain", 1.29, true, true},
+		{"TILECAL_LBA_m01_c00_highgain", 81.8, true, true},
+		{"TILECAL_EBC_m64_c02_highgain", 80, false, false},
+	} {
+		region := regions[table.hash]
+		region.AddEvent(tucs.Event{Run: run, Data: make(tucs.DataMap)})
+		err = w.ProcessRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := region.Events()[0].Data
+		if got := data["calibration"].(float64); float32(got) != float32(table.calib) {
+			t.Fatalf("%s: got calibration %v, want %v", table.hash, got, table.calib)
+		}
+		if got := data["chi2"].(float64); got != 1 {
+			t.Fatalf("%s: got chi2 %v, want 1", table.hash, got)
+		}
+		if got := data["good"].(bool); got != table.good {
+			t.Fatalf("%s: got good=%v, want %v", table.hash, got, table.good)
+		}
+		if got := data["linear"].(bool); got != table.linear {
+			t.Fatalf("%s: got linear=%v, want %v", table.hash, got, table.linear)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package cis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// adc_stat is the CIS calibration history of an ADC
+type adc_stat struct {
+	hash  string
+	calib []float64
+}
+
+// Recommendation is the evidence for updating the CIS constant of an ADC
+type Recommendation struct {
+	ADC     string  // ADC region hash (e.g. "LBA_m01_c05_highgain")
+	Name    string  // name of the CIS constant (e.g. "cis")
+	NRuns   int     // number of CIS runs used
+	Mean    float64 // mean CIS constant over the runs (ADC counts/pC)
+	RMS     float64 // RMS of the CIS constant over the runs
+	Current float64 // current constant
+	Dev     float64 // relative deviation of Mean from Current
+}
+
+// String returns the recommendation in the format read by
+// tucs.ParseConstants, with the evidence in a comment.
+func (r Recommendation) String() string {
+	return fmt.Sprintf("%s %s %.4f # n=%d mean=%.4f rms=%.4f current=%.4f dev=%+.2f%%",
+		r.ADC, r.Name, r.Mean, r.NRuns, r.Mean, r.RMS, r.Current, 100*r.Dev)
+}
+
+// stability is a tucs.Worker recommending the ADCs whose CIS constant moved
+type stability struct {
+	tucs.Base
+	consts    *tucs.ConstStore
+	name      string
+	tolerance float64
+	maxrms    float64
+	minruns   int
+	out       io.Writer
+	stats     []adc_stat
+	verbose   bool
+}
+
+type StabilityCfg struct {
+	Constants *tucs.ConstStore // current CIS constants (required)
+	Name      string           // name of the CIS constants in Constants (default: "cis")
+	Tolerance float64          // relative deviation above which an update is recommended (default: 0.01)
+	MaxRMS    float64          // maximum relative RMS of a stable ADC (default: 0.005)
+	MinRuns   int              // minimum number of good CIS runs (default: 2)
+	Output    io.Writer        // where to write the recommendations (default: os.Stdout)
+	Verbose   bool
+}
+
+// Stability returns a worker computing, for each ADC, the mean and RMS of the
+// CIS constant (see ReadCIS) over the selected runs which passed all the
+// quality checks, and comparing it to the current constant.
+//
+// The stable ADCs (relative RMS below MaxRMS over at least MinRuns runs)
+// whose mean deviates by more than Tolerance from the current constant are
+// recommended for update: they are written to Output, in the format read by
+// tucs.ParseConstants. The ADCs without a current constant are never
+// recommended, as there is nothing to compare them to.
+// The mean and RMS are also stored as "cis_mean" and "cis_rms" on the events.
+func Stability(rtype tucs.RegionType, cfg StabilityCfg) tucs.Worker {
+	w := &stability{
+		Base:      tucs.NewBase(rtype),
+		consts:    cfg.Constants,
+		name:      cfg.Name,
+		tolerance: cfg.Tolerance,
+		maxrms:    cfg.MaxRMS,
+		minruns:   cfg.MinRuns,
+		out:       cfg.Output,
+		verbose:   cfg.Verbose,
+	}
+	if w.name == "" {
+		w.name = "cis"
+	}
+	if w.tolerance <= 0 {
+		w.tolerance = 0.01
+	}
+	if w.maxrms <= 0 {
+		w.maxrms = 0.005
+	}
+	if w.minruns <= 0 {
+		w.minruns = 2
+	}
+	if w.out == nil {
+		w.out = os.Stdout
+	}
+	return w
+}
+
+func (w *stability) ProcessStart() error {
+	if w.consts == nil {
+		return fmt.Errorf("cis.Stability: no current CIS constants")
+	}
+	w.stats = w.stats[:0]
+	return nil
+}
+
+func (w *stability) ProcessRegion(region *tucs.Region) error {
+	if region.Type != tucs.Readout || len(region.Number(0, 0)) != 4 {
+		// CIS calibration is per ADC
+		return nil
+	}
+
+	stat := adc_stat{hash: strings.TrimPrefix(region.Hash(0, 0), "TILECAL_")}
+	for _, evt := range region.Events() {
+		calib, ok := evt.Data["calibration"].(float64)
+		if !ok || evt.Data["good"] != true {
+			continue
+		}
+		stat.calib = append(stat.calib, calib)
+	}
+	if len(stat.calib) == 0 {
+		return nil
+	}
+
+	mean, rms := mean_rms(stat.calib)
+	for _, evt := range region.Events() {
+		if _, ok := evt.Data["calibration"]; ok {
+			evt.Data["cis_mean"] = mean
+			evt.Data["cis_rms"] = rms
+		}
+	}
+	w.stats = append(w.stats, stat)
+	return nil
+}
+
+func (w *stability) ProcessStop() error {
+	recos := w.recommendations()
+	for _, r := range recos {
+		_, err := fmt.Fprintf(w.out, "%v\n", r)
+		if err != nil {
+			return fmt.Errorf("cis.Stability: could not write recommendations: %w", err)
+		}
+	}
+	fmt.Printf("cis.Stability: %d ADC(s) recommended for update (out of %d)\n", len(recos), len(w.stats))
+	w.stats = nil
+	return nil
+}
+
+// recommendations returns the ADCs recommended for update, ordered by hash.
+func (w *stability) recommendations() []Recommendation {
+	recos := make([]Recommendation, 0)
+	for _, stat := range w.stats {
+		mean, rms := mean_rms(stat.calib)
+		r := Recommendation{ADC: stat.hash, Name: w.name, NRuns: len(stat.calib), Mean: mean, RMS: rms}
+		switch {
+		case r.NRuns < w.minruns:
+			continue
+		case mean <= 0 || rms/mean > w.maxrms:
+			if w.verbose {
+				fmt.Printf("cis.Stability: unstable ADC, not recommended: %v\n", r)
+			}
+			continue
+		}
+		cur, ok := w.consts.Get(stat.hash, w.name)
+		if !ok || cur == 0 {
+			if w.verbose {
+				fmt.Printf("cis.Stability: no current constant, not recommended: %v\n", r)
+			}
+			continue
+		}
+		r.Current = cur
+		r.Dev = mean/cur - 1
+		if math.Abs(r.Dev) <= w.tolerance {
+			continue
+		}
+		recos = append(recos, r)
+	}
+	sort.Slice(recos, func(i, j int) bool { return recos[i].ADC < recos[j].ADC })
+	return recos
+}
+
+// mean_rms returns the mean and RMS of vals.
+func mean_rms(vals []float64) (mean, rms float64) {
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= float64(len(vals))
+	for _, v := range vals {
+		rms += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(rms / float64(len(vals)))
+}
+
+// check stability implements the tucs.Worker interface
+var _ tucs.Worker = (*stability)(nil)
@@ -0,0 +1,80 @@
+package cis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func TestStability(t *testing.T) {
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	consts := tucs.NewConstStore()
+	regions := adcs(tucs.TileCal(false, false))
+	for _, table := range []struct {
+		adc    string
+		calibs []float64
+		good   []bool
+		cur    float64 // 0: no current constant
+	}{
+		{"LBA_m01_c00_highgain", []float64{83, 83.1, 82.9}, []bool{true, true, true}, 81.8},    // moved
+		{"LBA_m01_c00_lowgain", []float64{1.29, 1.29, 1.29}, []bool{true, true, true}, 1.29},   // stable
+		{"LBA_m01_c01_highgain", []float64{83, 90, 76}, []bool{true, true, true}, 81.8},        // unstable
+		{"LBA_m01_c01_lowgain", []float64{1.35, 1.35, 1.35}, []bool{true, true, true}, 0},      // no constant
+		{"LBA_m01_c02_highgain", []float64{83, 70, 83}, []bool{true, false, true}, 81.8},       // moved, one bad run
+		{"LBA_m01_c02_lowgain", []float64{1.35, 1.35, 1.35}, []bool{true, false, false}, 1.29}, // too few good runs
+	} {
+		if table.cur != 0 {
+			consts.Set(table.adc, "cis", table.cur)
+		}
+		region := regions["TILECAL_"+table.adc]
+		for i, calib := range table.calibs {
+			run := tucs.Run{Type: string(tucs.CISRun), Number: int64(200004 + i), Time: t0, Data: make(tucs.DataMap)}
+			region.AddEvent(tucs.Event{Run: run, Data: tucs.DataMap{"calibration": calib, "good": table.good[i]}})
+		}
+	}
+
+	out := new(bytes.Buffer)
+	w := Stability(tucs.Readout, StabilityCfg{Constants: consts, Output: out})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, region := range regions {
+		err = w.ProcessRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.ProcessStop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		got = append(got, strings.Join(strings.Fields(line)[:3], " "))
+	}
+	want := []string{"LBA_m01_c00_highgain cis 83.0000", "LBA_m01_c02_highgain cis 83.0000"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got recommendations:\n%s\nwant:\n%s", out, strings.Join(want, "\n"))
+	}
+
+	recos, err := tucs.ParseConstants(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recos.Len() != 2 {
+		t.Fatalf("got %d constants, want 2", recos.Len())
+	}
+}
+
+func TestStabilityNoConstants(t *testing.T) {
+	w := Stability(tucs.Readout, StabilityCfg{})
+	err := w.ProcessStart()
+	if err == nil {
+		t.Fatalf("expected an error without current constants")
+	}
+}
@@ -0,0 +1,86 @@
+package laser
+
+import (
+	"math"
+)
+
+// ndiodes is the number of PIN diodes of the laser box
+const ndiodes = 4
+
+// diode_signal returns the response of the PIN diode selected for the
+// normalisation, or the average of the box diodes, with its uncertainty.
+// It returns false if no diode saw any light.
+func (w *readlaser) diode_signal(data *laser_data) (sig, err float64, ok bool) {
+	diodes := []int{w.diode}
+	if w.diode < 0 {
+		diodes = []int{0, 1, 2, 3}
+	}
+	n := 0
+	for _, i := range diodes {
+		if data.diode[i] <= 0 || data.diode_evt[i] <= 0 {
+			continue
+		}
+		sig += data.diode[i]
+		err += sq(data.diode_rms[i]) / data.diode_evt[i]
+		n++
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	return sig / float64(n), math.Sqrt(err) / float64(n), true
+}
+
+// raw_ratio returns the ratio of the laser signal of an ADC to the diode
+// signal, with its uncertainty.
+func (w *readlaser) raw_ratio(data *laser_data, ros, mod, ch, gain int) (ratio, err float64, ok bool) {
+	sig := data.signal[ros][mod][ch][gain]
+	nevts := data.entries[ros][mod][ch][gain]
+	if nevts <= 0 {
+		return 0, 0, false
+	}
+	diode, diode_err, ok := w.diode_signal(data)
+	if !ok {
+		return 0, 0, false
+	}
+	sig_err := data.rms[ros][mod][ch][gain] / math.Sqrt(nevts)
+	ratio = sig / diode
+	err = math.Abs(ratio) * math.Sqrt(
+		sq(sig_err/sig)+sq(diode_err/diode),
+	)
+	if sig == 0 {
+		err = sig_err / diode
+	}
+	return ratio, err, true
+}
+
+// mean_ratios computes the mean raw ratio of each partition and gain, over
+// the ADCs with enough events and some signal.
+func (w *readlaser) mean_ratios(data *laser_data) {
+	for ros := range data.signal {
+		for gain := 0; gain < 2; gain++ {
+			sum := 0.0
+			n := 0
+			for mod := range data.signal[ros] {
+				for ch := range data.signal[ros][mod] {
+					if data.entries[ros][mod][ch][gain] < float64(w.nevtcut) ||
+						data.signal[ros][mod][ch][gain] <= 0 {
+						continue
+					}
+					ratio, _, ok := w.raw_ratio(data, ros, mod, ch, gain)
+					if !ok {
+						continue
+					}
+					sum += ratio
+					n++
+				}
+			}
+			if n > 0 {
+				data.mean[ros][gain] = sum / float64(n)
+			}
+		}
+	}
+}
+
+func sq(x float64) float64 {
+	return x * x
+}
@@ -0,0 +1,141 @@
+package laser
+
+import (
+	"fmt"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// fibre identifies a laser fibre of the patch panel: each drawer is fed by two
+// fibres, one for its odd PMTs and one for its even PMTs
+type fibre struct {
+	ros    int // 1=LBA, 2=LBC, 3=EBA, 4=EBC
+	module int
+	odd    bool
+}
+
+func (f fibre) String() string {
+	parity := "even"
+	if f.odd {
+		parity = "odd"
+	}
+	return fmt.Sprintf("%s_m%02d_%s", tucs.Partitions()[f.ros-1], f.module, parity)
+}
+
+// fibrecorr is a tucs.Worker correcting the laser gain variations for the
+// effects of the patch panel fibres
+type fibrecorr struct {
+	tucs.Base
+	minadcs int
+	evts    map[fibre][]laser_evt
+	verbose bool
+}
+
+type FibreCorrCfg struct {
+	MinADCs int // minimum number of ADCs of a fibre to compute its correction (default: 5)
+	Verbose bool
+}
+
+// FibreCorr returns a worker computing, for each laser run, gain and fibre,
+// the fibre correction as the median variation of the ADCs sharing the fibre.
+// The variations used are the "gain_var_corr" of GlobalShift if available,
+// "gain_var" (see RelGain) otherwise. The correction is stored as
+// "fibre_shift" and removed from "gain_var_corr" on the events.
+// Fibres with less than MinADCs ADCs are left uncorrected, and so are the runs
+// GlobalShift could not correct (flagged with "no_global_shift"): they are not
+// used to compute the corrections either.
+func FibreCorr(rtype tucs.RegionType, cfg FibreCorrCfg) tucs.Worker {
+	minadcs := cfg.MinADCs
+	if minadcs <= 0 {
+		minadcs = 5
+	}
+	w := &fibrecorr{
+		Base:    tucs.NewBase(rtype),
+		minadcs: minadcs,
+		evts:    make(map[fibre][]laser_evt),
+		verbose: cfg.Verbose,
+	}
+	return w
+}
+
+func (w *fibrecorr) ProcessStart() error {
+	w.evts = make(map[fibre][]laser_evt)
+	return nil
+}
+
+func (w *fibrecorr) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 4 {
+		// laser data is per ADC
+		return nil
+	}
+	pmt := region.Number(1, 0)[2]
+	f := fibre{ros: nbr[0], module: nbr[1], odd: pmt%2 == 1}
+	for _, evt := range region.Events() {
+		if _, ok := gain_var(evt.Data); !ok || evt.Run.Type != string(tucs.LaserRun) {
+			continue
+		}
+		w.evts[f] = append(w.evts[f], laser_evt{run: evt.Run.Number, gain: nbr[3], data: evt.Data})
+	}
+	return nil
+}
+
+// gain_var returns the gain variation of an event, corrected for the global
+// shift if available. It returns false if there is none, or if the global
+// shift of the run could not be computed.
+func gain_var(data tucs.DataMap) (float64, bool) {
+	if skip, _ := data["no_global_shift"].(bool); skip {
+		return 0, false
+	}
+	if v, ok := data["gain_var_corr"].(float64); ok {
+		return v, true
+	}
+	v, ok := data["gain_var"].(float64)
+	return v, ok
+}
+
+func (w *fibrecorr) ProcessStop() error {
+	type key struct {
+		run  int64
+		gain int
+	}
+	for f, evts := range w.evts {
+		vars := make(map[key][]float64)
+		for _, evt := range evts {
+			v, _ := gain_var(evt.data)
+			k := key{evt.run, evt.gain}
+			vars[k] = append(vars[k], v)
+		}
+
+		shifts := make(map[key]float64, len(vars))
+		for k, v := range vars {
+			if len(v) < w.minadcs {
+				if w.verbose {
+					fmt.Printf("laser.FibreCorr: run %d, gain %d, fibre %v: only %d ADC(s), no correction\n",
+						k.run, k.gain, f, len(v))
+				}
+				continue
+			}
+			shifts[k] = median(v)
+			if w.verbose {
+				fmt.Printf("laser.FibreCorr: run %d, gain %d, fibre %v: correction %.3f%% (%d ADCs)\n",
+					k.run, k.gain, f, shifts[k], len(v))
+			}
+		}
+
+		for _, evt := range evts {
+			shift, ok := shifts[key{evt.run, evt.gain}]
+			if !ok {
+				continue
+			}
+			v, _ := gain_var(evt.data)
+			evt.data["fibre_shift"] = shift
+			evt.data["gain_var_corr"] = remove_shift(v, shift)
+		}
+	}
+	w.evts = make(map[fibre][]laser_evt)
+	return nil
+}
+
+// check fibrecorr implements the tucs.Worker interface
+var _ tucs.Worker = (*fibrecorr)(nil)
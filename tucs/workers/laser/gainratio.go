@@ -0,0 +1,156 @@
+package laser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// gain_ratio is the high/low gain ratio of a channel for a run
+type gain_ratio struct {
+	channel *tucs.Region
+	ratio   float64
+	data    [2]tucs.DataMap // data of the low and high gain laser events
+}
+
+// gainratio is a tucs.Worker checking the consistency of the laser signals of
+// the high and low gain ADCs of each channel
+type gainratio struct {
+	tucs.Base
+	tolerance float64
+	ratios    map[int64][4][]gain_ratio // ratios of each run and partition
+	verbose   bool
+}
+
+type GainRatioCfg struct {
+	Tolerance float64 // maximum relative deviation from the partition median (default: 0.05)
+	Verbose   bool
+}
+
+// GainRatio returns a worker computing, for each laser run, the ratio of the
+// high gain to the low gain "signal" (see ReadLaser) of each channel, and
+// flagging the channels whose ratio deviates by more than Tolerance from the
+// median ratio of their partition.
+//
+// The results are stored on the laser events of both ADCs of the channels, as
+// "hg_lg_ratio", "hg_lg_median", "hg_lg_dev" (relative deviation from the
+// median) and "hg_lg_bad".
+func GainRatio(rtype tucs.RegionType, cfg GainRatioCfg) tucs.Worker {
+	tol := cfg.Tolerance
+	if tol <= 0 {
+		tol = 0.05
+	}
+	w := &gainratio{
+		Base:      tucs.NewBase(rtype),
+		tolerance: tol,
+		ratios:    make(map[int64][4][]gain_ratio),
+		verbose:   cfg.Verbose,
+	}
+	return w
+}
+
+func (w *gainratio) ProcessStart() error {
+	w.ratios = make(map[int64][4][]gain_ratio)
+	return nil
+}
+
+func (w *gainratio) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if len(nbr) != 3 || region.Type != tucs.Readout {
+		// channels only
+		return nil
+	}
+	ros := nbr[0] - 1
+
+	var adcs [2]*tucs.Region
+	for _, adc := range region.Children(tucs.Readout) {
+		switch adc.Name(0) {
+		case "lowgain":
+			adcs[0] = adc
+		case "highgain":
+			adcs[1] = adc
+		}
+	}
+	if adcs[0] == nil || adcs[1] == nil {
+		return nil
+	}
+
+	lg := make(map[int64]tucs.DataMap)
+	for _, evt := range adcs[0].Events() {
+		if _, ok := evt.Data["signal"].(float64); ok && evt.Run.Type == string(tucs.LaserRun) {
+			lg[evt.Run.Number] = evt.Data
+		}
+	}
+	for _, evt := range adcs[1].Events() {
+		hg, ok := evt.Data["signal"].(float64)
+		if !ok || evt.Run.Type != string(tucs.LaserRun) {
+			continue
+		}
+		data, ok := lg[evt.Run.Number]
+		sig, _ := data["signal"].(float64)
+		if !ok || sig <= 0 {
+			if w.verbose {
+				fmt.Printf("laser.GainRatio: run %d: no low gain signal for: %v\n",
+					evt.Run.Number, region.Hash(0, 0))
+			}
+			continue
+		}
+		lst := w.ratios[evt.Run.Number]
+		lst[ros] = append(lst[ros], gain_ratio{channel: region, ratio: hg / sig, data: [2]tucs.DataMap{data, evt.Data}})
+		w.ratios[evt.Run.Number] = lst
+	}
+	return nil
+}
+
+func (w *gainratio) ProcessStop() error {
+	iruns := make([]int64, 0, len(w.ratios))
+	for irun := range w.ratios {
+		iruns = append(iruns, irun)
+	}
+	sort.Slice(iruns, func(i, j int) bool { return iruns[i] < iruns[j] })
+
+	for _, irun := range iruns {
+		for ros, lst := range w.ratios[irun] {
+			if len(lst) == 0 {
+				continue
+			}
+			vals := make([]float64, len(lst))
+			for i, r := range lst {
+				vals[i] = r.ratio
+			}
+			med := median(vals)
+			nbad := 0
+			for _, r := range lst {
+				dev := math.Inf(1)
+				if med != 0 {
+					dev = r.ratio/med - 1
+				}
+				bad := math.Abs(dev) > w.tolerance
+				if bad {
+					nbad++
+					if w.verbose {
+						fmt.Printf("laser.GainRatio: run %d: high/low gain ratio %.3f deviates by %.1f%% for: %v\n",
+							irun, r.ratio, 100*dev, r.channel.Hash(0, 0))
+					}
+				}
+				for _, data := range r.data {
+					data["hg_lg_ratio"] = r.ratio
+					data["hg_lg_median"] = med
+					data["hg_lg_dev"] = dev
+					data["hg_lg_bad"] = bad
+				}
+			}
+			if nbad > 0 {
+				fmt.Printf("laser.GainRatio: run %d: %d/%d channel(s) of %s with an inconsistent high/low gain ratio\n",
+					irun, nbad, len(lst), tucs.Partitions()[ros])
+			}
+		}
+	}
+	w.ratios = make(map[int64][4][]gain_ratio)
+	return nil
+}
+
+// check gainratio implements the tucs.Worker interface
+var _ tucs.Worker = (*gainratio)(nil)
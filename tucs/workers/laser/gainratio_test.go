@@ -0,0 +1,79 @@
+package laser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func TestGainRatio(t *testing.T) {
+	run := tucs.Run{Type: "Las", Number: 200001, Time: time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC), Data: make(tucs.DataMap)}
+	const bad = "TILECAL_LBA_m01_c00"
+
+	tilecal := tucs.TileCal(false, false)
+	regions := adcs(tilecal)
+	for hash, region := range regions {
+		if !strings.HasPrefix(hash, "TILECAL_LBA_") {
+			continue
+		}
+		sig := 1.0
+		switch {
+		case hash == bad+"_highgain":
+			sig = 50
+		case strings.HasSuffix(hash, "_highgain"):
+			sig = 40
+		}
+		region.AddEvent(tucs.Event{Run: run, Data: tucs.DataMap{"signal": sig}})
+	}
+
+	w := GainRatio(tucs.Readout, GainRatioCfg{})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tilecal.IterRegions(tucs.Readout, func(_ tucs.RegionType, region *tucs.Region) error {
+		return w.ProcessRegion(region)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.ProcessStop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []struct {
+		hash  string
+		ratio float64
+		bad   bool
+	}{
+		{bad + "_highgain", 50, true},
+		{bad + "_lowgain", 50, true},
+		{"TILECAL_LBA_m02_c00_highgain", 40, false},
+		{"TILECAL_LBA_m02_c00_lowgain", 40, false},
+	} {
+		evts := regions[table.hash].Events()
+		if len(evts) != 1 {
+			t.Fatalf("%s: got %d events, want 1", table.hash, len(evts))
+		}
+		data := evts[0].Data
+		if got := data["hg_lg_ratio"].(float64); got != table.ratio {
+			t.Fatalf("%s: got ratio %v, want %v", table.hash, got, table.ratio)
+		}
+		if got := data["hg_lg_median"].(float64); got != 40 {
+			t.Fatalf("%s: got median ratio %v, want 40", table.hash, got)
+		}
+		if got := data["hg_lg_bad"].(bool); got != table.bad {
+			t.Fatalf("%s: got bad=%v, want %v", table.hash, got, table.bad)
+		}
+	}
+
+	// the channels get no events
+	for _, ch := range regions[bad+"_highgain"].Parent(tucs.Readout, 0).Parent(tucs.Readout, 0).Children(tucs.Readout) {
+		if evts := ch.Events(); len(evts) != 0 {
+			t.Fatalf("%s: got events %v", ch.Hash(0, 0), evts)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package laser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// laser_evt is the gain variation of an ADC for a run, as collected by the
+// correction workers
+type laser_evt struct {
+	run    int64
+	gain   int
+	stable bool // whether the ADC belongs to a stable cell
+	data   tucs.DataMap
+}
+
+// globalshift is a tucs.Worker correcting the laser gain variations for the
+// common shift of the laser light intensity
+type globalshift struct {
+	tucs.Base
+	cells   []string
+	minadcs int
+	evts    []laser_evt
+	verbose bool
+}
+
+type GlobalShiftCfg struct {
+	Cells   []string // stable cells, as parts of cell names (default: the D cells, "_sD_")
+	MinADCs int      // minimum number of stable ADCs to compute a shift (default: 10)
+	Verbose bool
+}
+
+// GlobalShift returns a worker computing, for each laser run and gain, the
+// global shift of the light intensity as the median "gain_var" (see RelGain)
+// of the ADCs of the stable cells. The shift is removed from the variations of
+// all the ADCs: it is stored as "global_shift" and the corrected variation as
+// "gain_var_corr" on the events.
+// Runs with less than MinADCs stable ADCs are left uncorrected, and their
+// events flagged with "no_global_shift".
+func GlobalShift(rtype tucs.RegionType, cfg GlobalShiftCfg) tucs.Worker {
+	cells := cfg.Cells
+	if len(cells) == 0 {
+		cells = []string{"_sD_"}
+	}
+	minadcs := cfg.MinADCs
+	if minadcs <= 0 {
+		minadcs = 10
+	}
+	w := &globalshift{
+		Base:    tucs.NewBase(rtype),
+		cells:   cells,
+		minadcs: minadcs,
+		verbose: cfg.Verbose,
+	}
+	return w
+}
+
+func (w *globalshift) ProcessStart() error {
+	w.evts = w.evts[:0]
+	return nil
+}
+
+func (w *globalshift) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 4 {
+		// laser data is per ADC
+		return nil
+	}
+	stable := w.is_stable(region)
+	for _, evt := range region.Events() {
+		if _, ok := evt.Data["gain_var"].(float64); !ok || evt.Run.Type != string(tucs.LaserRun) {
+			continue
+		}
+		w.evts = append(w.evts, laser_evt{run: evt.Run.Number, gain: nbr[3], stable: stable, data: evt.Data})
+	}
+	return nil
+}
+
+// is_stable returns whether the ADC region belongs to one of the stable cells.
+func (w *globalshift) is_stable(adc *tucs.Region) bool {
+	cell := adc.Parent(tucs.Readout, 0).Parent(tucs.Physical, 0)
+	if cell == nil || cell.Type != tucs.Physical {
+		return false
+	}
+	hash := cell.Hash(0, 0)
+	for _, name := range w.cells {
+		if strings.Contains(hash, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *globalshift) ProcessStop() error {
+	type key struct {
+		run  int64
+		gain int
+	}
+	vars := make(map[key][]float64)
+	for _, evt := range w.evts {
+		if evt.stable {
+			k := key{evt.run, evt.gain}
+			vars[k] = append(vars[k], evt.data["gain_var"].(float64))
+		}
+	}
+
+	shifts := make(map[key]float64, len(vars))
+	for k, v := range vars {
+		if len(v) < w.minadcs {
+			fmt.Printf("**warning** laser.GlobalShift: run %d, gain %d: only %d stable ADC(s), no correction\n",
+				k.run, k.gain, len(v))
+			continue
+		}
+		shifts[k] = median(v)
+		if w.verbose {
+			fmt.Printf("laser.GlobalShift: run %d, gain %d: global shift %.3f%% (%d ADCs)\n",
+				k.run, k.gain, shifts[k], len(v))
+		}
+	}
+
+	for _, evt := range w.evts {
+		shift, ok := shifts[key{evt.run, evt.gain}]
+		if !ok {
+			evt.data["no_global_shift"] = true
+			continue
+		}
+		delete(evt.data, "no_global_shift")
+		evt.data["global_shift"] = shift
+		evt.data["gain_var_corr"] = remove_shift(evt.data["gain_var"].(float64), shift)
+	}
+	w.evts = nil
+	return nil
+}
+
+// remove_shift removes the relative shift (in %) from the relative variation
+// v (in %).
+func remove_shift(v, shift float64) float64 {
+	return 100 * ((1+v/100)/(1+shift/100) - 1)
+}
+
+// median returns the median of vals, reordering them.
+func median(vals []float64) float64 {
+	sort.Float64s(vals)
+	n := len(vals)
+	if n%2 == 1 {
+		return vals[n/2]
+	}
+	return 0.5 * (vals[n/2-1] + vals[n/2])
+}
+
+// check globalshift implements the tucs.Worker interface
+var _ tucs.Worker = (*globalshift)(nil)
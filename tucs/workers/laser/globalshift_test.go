@@ -0,0 +1,81 @@
+package laser
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func TestGlobalShiftFibreCorr(t *testing.T) {
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	run1 := tucs.Run{Type: "Las", Number: 200001, Time: t0, Data: make(tucs.DataMap)}
+	run2 := tucs.Run{Type: "Las", Number: 200002, Time: t0, Data: make(tucs.DataMap)}
+
+	const shifted = "TILECAL_LBA_m01_c05_highgain" // PMT 6, not in a D cell
+	gs := GlobalShift(tucs.Readout, GlobalShiftCfg{})
+	regions := adcs(tucs.TileCal(false, false))
+	if regions[shifted] == nil {
+		t.Fatalf("no ADC %s", shifted)
+	}
+	for hash, region := range regions {
+		v := 2.0
+		if hash == shifted {
+			v = 5
+		}
+		region.AddEvent(tucs.Event{Run: run1, Data: tucs.DataMap{"gain_var": v}})
+		// no stable ADC in run 2
+		if !gs.(*globalshift).is_stable(region) {
+			region.AddEvent(tucs.Event{Run: run2, Data: tucs.DataMap{"gain_var": 1.0}})
+		}
+	}
+
+	fc := FibreCorr(tucs.Readout, FibreCorrCfg{})
+	for _, w := range []tucs.Worker{gs, fc} {
+		err := w.ProcessStart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, region := range regions {
+			err = w.ProcessRegion(region)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = w.ProcessStop()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for hash, region := range regions {
+		for _, evt := range region.Events() {
+			switch evt.Run.Number {
+			case run1.Number:
+				if got := evt.Data["global_shift"].(float64); got != 2 {
+					t.Fatalf("%s: got global shift %v, want 2", hash, got)
+				}
+				if got := evt.Data["fibre_shift"].(float64); got != 0 {
+					t.Fatalf("%s: got fibre shift %v, want 0", hash, got)
+				}
+				want := 0.0
+				if hash == shifted {
+					want = 100 * (1.05/1.02 - 1)
+				}
+				if got := evt.Data["gain_var_corr"].(float64); math.Abs(got-want) > 1e-9 {
+					t.Fatalf("%s: got corrected variation %v, want %v", hash, got, want)
+				}
+			case run2.Number:
+				if flag, _ := evt.Data["no_global_shift"].(bool); !flag {
+					t.Fatalf("%s: run without global shift not flagged", hash)
+				}
+				for _, k := range []string{"global_shift", "fibre_shift", "gain_var_corr"} {
+					if v, ok := evt.Data[k]; ok {
+						t.Fatalf("%s: run without global shift got %s=%v", hash, k, v)
+					}
+				}
+			}
+		}
+	}
+}
@@ -2,11 +2,25 @@ package laser
 
 import (
 	"fmt"
-	"path"
 
 	"github.com/sbinet/go-tucs/tucs"
 )
 
+// laser_tree is the name of the tree of the laser ntuples
+const laser_tree = "h3000"
+
+// laser_data holds the per-ADC laser data of a run
+type laser_data struct {
+	signal    tucs.ADCArray    // mean laser signal
+	rms       tucs.ADCArray    // RMS of the laser signal
+	entries   tucs.ADCArray    // number of events
+	diode     [ndiodes]float64 // mean PIN diode responses
+	diode_rms [ndiodes]float64 // RMS of the PIN diode responses
+	diode_evt [ndiodes]float64 // number of events of the PIN diodes
+	boxpar    []float64        // laser box parameters
+	mean      [4][2]float64    // mean raw ratio of each partition and gain
+}
+
 // readlaser is a tucs.Worker to read-laser data
 type readlaser struct {
 	tucs.CalibBase
@@ -15,25 +29,41 @@ type readlaser struct {
 	boxpar  bool
 	runmap  map[int64][]tucs.Event
 	runs    []tucs.Run
+	data    map[int64]*laser_data
 	verbose bool
 }
 
 type ReadLaserCfg struct {
 	WorkDir  string // name of the directory holding data
-	DiodeNbr int
-	BoxPar   bool
+	DiodeNbr int    // PIN diode (0-3) normalising the PMT signals, -1 for the average of the box diodes
+	BoxPar   bool   // read the laser box parameters, stored as "boxpar" in Run.Data
+	NEvtCut  int    // minimum number of events of an ADC (default: 10)
 	Verbose  bool
 }
 
-// ReadLaser returns a read-laser worker
+// ReadLaser returns a read-laser worker.
+// It reads the mean laser signal, its RMS and the number of events of each ADC
+// from the laser ntuples of the runs selected by the Filter, and stores them
+// as "signal", "rms" and "n_events" in the Data of the events of the gain
+// regions. The events of ADCs with less than NEvtCut events are dropped.
+//
+// The PMT signals are normalised by the PIN diode DiodeNbr (or the average of
+// the box diodes): the ratios to the diode are stored as "raw_ratio" and
+// "raw_ratio_err", and the same ratios divided by the mean ratio of the
+// partition and gain in the run as "ratio" and "ratio_err".
 func ReadLaser(rtype tucs.RegionType, cfg ReadLaserCfg) tucs.Worker {
+	nevtcut := cfg.NEvtCut
+	if nevtcut <= 0 {
+		nevtcut = 10
+	}
 	w := &readlaser{
 		CalibBase: tucs.NewCalibBase(rtype, cfg.WorkDir),
-		nevtcut:   10,
+		nevtcut:   nevtcut,
 		diode:     cfg.DiodeNbr,
 		boxpar:    cfg.BoxPar,
 		runmap:    make(map[int64][]tucs.Event),
 		runs:      make([]tucs.Run, 0),
+		data:      make(map[int64]*laser_data),
 		verbose:   cfg.Verbose,
 	}
 
@@ -41,34 +71,119 @@ func ReadLaser(rtype tucs.RegionType, cfg ReadLaserCfg) tucs.Worker {
 }
 
 func (w *readlaser) ProcessStart() error {
+	if w.diode < -1 || w.diode >= ndiodes {
+		return fmt.Errorf("laser.ReadLaser: invalid diode %d (expected 0 to %d, or -1 for the box average)", w.diode, ndiodes-1)
+	}
 	fmt.Printf("grun-list: %v\n", len(tucs.Runs))
-	for _, run := range tucs.Runs {
-		fname := path.Join(w.CalibBase.Dir(),
-			fmt.Sprintf("tileCalibLAS_%v_Las.0.root", run.Number))
-		if tucs.PathExists(fname) {
-			run.Data["filename"] = path.Base(fname)
+	w.ReadRuns("laser.ReadLaser", tucs.LaserRun,
+		func(run tucs.Run) string {
+			return fmt.Sprintf("tileCalibLAS_%v_Las.0.root", run.Number)
+		},
+		func(run tucs.Run, fname string) error {
+			data, err := w.read(fname)
+			if err != nil {
+				return err
+			}
+			run.Data["diode"] = data.diode
+			if w.boxpar {
+				run.Data["boxpar"] = data.boxpar
+			}
 			w.runs = append(w.runs, run)
 			w.runmap[run.Number] = nil
-			fmt.Printf("file: %v\n", fname)
-		} else {
-			fmt.Printf("not yet processed, removing: %v\n", run)
-			tucs.Runs.Remove(run)
-		}
+			w.data[run.Number] = data
+			return nil
+		},
+	)
+	return nil
+}
+
+func (w *readlaser) ProcessStop() error {
+	return w.CloseFiles()
+}
+
+// read reads the per-ADC laser data of the laser ntuple fname
+func (w *readlaser) read(fname string) (*laser_data, error) {
+	branches := []string{"signal", "rms", "entries", "diode", "diode_rms", "diode_entries"}
+	if w.boxpar {
+		branches = append(branches, "boxpar")
+	}
+	vals, err := w.ReadEntry(fname, laser_tree, 0, branches...)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != len(branches) {
+		return nil, fmt.Errorf("missing laser branches in %q (expected %v)", fname, branches)
 	}
 
-	return nil
+	data := &laser_data{boxpar: vals["boxpar"]}
+	for name, dst := range map[string]*tucs.ADCArray{
+		"signal":  &data.signal,
+		"rms":     &data.rms,
+		"entries": &data.entries,
+	} {
+		err = dst.Set(vals[name])
+		if err != nil {
+			return nil, fmt.Errorf("branch %q of %q holds %w", name, fname, err)
+		}
+	}
+	for name, dst := range map[string]*[ndiodes]float64{
+		"diode":         &data.diode,
+		"diode_rms":     &data.diode_rms,
+		"diode_entries": &data.diode_evt,
+	} {
+		v := vals[name]
+		if len(v) != ndiodes {
+			return nil, fmt.Errorf("branch %q of %q holds %d values (expected %d)", name, fname, len(v), ndiodes)
+		}
+		copy(dst[:], v)
+	}
+	w.mean_ratios(data)
+	return data, nil
 }
 
 func (w *readlaser) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 4 {
+		// laser data is per ADC
+		return nil
+	}
+	ros, mod, ch, gain := nbr[0]-1, nbr[1]-1, nbr[2], nbr[3]
 
-	for _, evt := range region.Events() {
-		if evt.Run.Type != "Las" {
+	events := region.Events()
+	keep := events[:0]
+	for _, evt := range events {
+		data, ok := w.data[evt.Run.Number]
+		if evt.Run.Type != string(tucs.LaserRun) || !ok {
+			keep = append(keep, evt)
+			continue
+		}
+		nevts := data.entries[ros][mod][ch][gain]
+		if nevts < float64(w.nevtcut) {
+			if w.verbose {
+				fmt.Printf("run %d: %v events only, removing: %v\n",
+					evt.Run.Number, nevts, region.Hash(0, 0))
+			}
 			continue
 		}
-		if _, ok := evt.Run.Data["filename"]; ok {
-			w.runmap[evt.Run.Number] = append(w.runmap[evt.Run.Number], evt)
+		evt.Data["signal"] = data.signal[ros][mod][ch][gain]
+		evt.Data["rms"] = data.rms[ros][mod][ch][gain]
+		evt.Data["n_events"] = nevts
+		raw, raw_err, ok := w.raw_ratio(data, ros, mod, ch, gain)
+		if ok {
+			evt.Data["raw_ratio"] = raw
+			evt.Data["raw_ratio_err"] = raw_err
+			if mean := data.mean[ros][gain]; mean > 0 {
+				evt.Data["ratio"] = raw / mean
+				evt.Data["ratio_err"] = raw_err / mean
+			}
+		} else if w.verbose {
+			fmt.Printf("run %d: no diode signal, no laser ratio for: %v\n",
+				evt.Run.Number, region.Hash(0, 0))
 		}
+		w.runmap[evt.Run.Number] = append(w.runmap[evt.Run.Number], evt)
+		keep = append(keep, evt)
 	}
+	region.SetEvents(keep)
 	return nil
 }
 
@@ -0,0 +1,160 @@
+package laser
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+// adc_array holds a value per ADC, as stored in the laser ntuples
+type adc_array [4][64][48][2]float32
+
+// write_ntuple writes the laser ntuple fname, whose single entry holds the
+// values pointed at by vars.
+func write_ntuple(t *testing.T, fname string, vars map[string]interface{}) {
+	t.Helper()
+	f, err := groot.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	wvars := make([]rtree.WriteVar, 0, len(vars))
+	for _, name := range names {
+		wvars = append(wvars, rtree.WriteVar{Name: name, Value: vars[name]})
+	}
+	tree, err := rtree.NewWriter(f, laser_tree, wvars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tree.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// adcs returns the ADC regions of tilecal, by hash
+func adcs(tilecal *tucs.Region) map[string]*tucs.Region {
+	regions := make(map[string]*tucs.Region)
+	tilecal.IterRegions(tucs.Readout, func(t tucs.RegionType, region *tucs.Region) error {
+		if len(region.Number(0, 0)) == 4 {
+			regions[region.Hash(0, 0)] = region
+		}
+		return nil
+	})
+	return regions
+}
+
+func TestReadLaser(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		signal, rms, entries adc_array
+		diode                = [ndiodes]float32{50, 0, 0, 0}
+		diode_rms            = [ndiodes]float32{5, 0, 0, 0}
+		diode_entries        = [ndiodes]float32{100, 0, 0, 0}
+	)
+	for ros := range signal {
+		for mod := range signal[ros] {
+			for ch := range signal[ros][mod] {
+				for gain := range signal[ros][mod][ch] {
+					signal[ros][mod][ch][gain] = 10
+					rms[ros][mod][ch][gain] = 1
+					entries[ros][mod][ch][gain] = 100
+				}
+			}
+		}
+	}
+	signal[0][0][0][1] = 20 // LBA_m01_c00_highgain
+	entries[0][0][1][1] = 5 // LBA_m01_c01_highgain
+	write_ntuple(t, filepath.Join(dir, "tileCalibLAS_200001_Las.0.root"), map[string]interface{}{
+		"signal":        &signal,
+		"rms":           &rms,
+		"entries":       &entries,
+		"diode":         &diode,
+		"diode_rms":     &diode_rms,
+		"diode_entries": &diode_entries,
+	})
+
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	run := tucs.Run{Type: "Las", Number: 200001, Time: t0, Data: make(tucs.DataMap)}
+	tucs.Runs = tucs.RunList{
+		run,
+		{Type: "Las", Number: 200002, Time: t0, Data: make(tucs.DataMap)}, // no ntuple
+	}
+
+	w := ReadLaser(tucs.Readout, ReadLaserCfg{WorkDir: dir, DiodeNbr: 0})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+	if len(tucs.Runs) != 1 || tucs.Runs[0].Number != 200001 {
+		t.Fatalf("got runs %v, want [200001]", tucs.Runs)
+	}
+
+	regions := adcs(tucs.TileCal(false, false))
+	for _, hash := range []string{
+		"TILECAL_LBA_m01_c00_highgain",
+		"TILECAL_LBA_m01_c00_lowgain",
+		"TILECAL_LBA_m01_c01_highgain",
+	} {
+		region := regions[hash]
+		region.AddEvent(tucs.Event{Run: run, Data: make(tucs.DataMap)})
+		err = w.ProcessRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evts := regions["TILECAL_LBA_m01_c01_highgain"].Events()
+	if len(evts) != 0 {
+		t.Fatalf("ADC with too few events kept: %v", evts)
+	}
+
+	for _, table := range []struct {
+		hash   string
+		signal float64
+		raw    float64
+	}{
+		{"TILECAL_LBA_m01_c00_highgain", 20, 20. / 50},
+		{"TILECAL_LBA_m01_c00_lowgain", 10, 10. / 50},
+	} {
+		evts := regions[table.hash].Events()
+		if len(evts) != 1 {
+			t.Fatalf("%s: got %d events, want 1", table.hash, len(evts))
+		}
+		data := evts[0].Data
+		if got := data["signal"].(float64); got != table.signal {
+			t.Fatalf("%s: got signal %v, want %v", table.hash, got, table.signal)
+		}
+		if got := data["n_events"].(float64); got != 100 {
+			t.Fatalf("%s: got %v events, want 100", table.hash, got)
+		}
+		if got := data["raw_ratio"].(float64); math.Abs(got-table.raw) > 1e-9 {
+			t.Fatalf("%s: got raw ratio %v, want %v", table.hash, got, table.raw)
+		}
+		// the mean ratio of the partition is about 10/50
+		if got := data["ratio"].(float64); math.Abs(got-table.raw/0.2) > 1e-2 {
+			t.Fatalf("%s: got ratio %v, want about %v", table.hash, got, table.raw/0.2)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package laser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// relgain is a tucs.Worker computing the PMT gain variations relative to a
+// reference laser run
+type relgain struct {
+	tucs.Base
+	refrun  int64
+	consts  *tucs.ConstStore
+	verbose bool
+}
+
+type RelGainCfg struct {
+	RefRun    int64            // reference laser run (0: earliest run with data, per channel)
+	Constants *tucs.ConstStore // reference ratios ("laser_ref" and "laser_ref_err"), used first when not nil
+	Verbose   bool
+}
+
+// RelGain returns a worker computing, for each ADC, the variation of the
+// laser "raw_ratio" (see ReadLaser) relative to the one of a reference run.
+// The reference is taken from the Constants store if it holds a "laser_ref"
+// for the ADC, from the RefRun event otherwise.
+//
+// The variation (in %) and its uncertainty are stored as "gain_var" and
+// "gain_var_err" on the events, along with "ref_run" (0 when the reference
+// comes from the Constants store). Events without a ratio, or of ADCs without
+// a reference, are left untouched.
+func RelGain(rtype tucs.RegionType, cfg RelGainCfg) tucs.Worker {
+	w := &relgain{
+		Base:    tucs.NewBase(rtype),
+		refrun:  cfg.RefRun,
+		consts:  cfg.Constants,
+		verbose: cfg.Verbose,
+	}
+	return w
+}
+
+// reference returns the reference ratio of an ADC, its uncertainty and run.
+func (w *relgain) reference(region *tucs.Region, events []tucs.Event) (ref, ref_err float64, run int64, ok bool) {
+	if w.consts != nil {
+		hash := region.Hash(0, 0)
+		if ref, ok = w.consts.Get(hash, "laser_ref"); ok {
+			ref_err, _ = w.consts.Get(hash, "laser_ref_err")
+			return ref, ref_err, 0, true
+		}
+	}
+
+	for _, evt := range events {
+		if w.refrun != 0 && evt.Run.Number != w.refrun {
+			continue
+		}
+		ratio, ok1 := evt.Data["raw_ratio"].(float64)
+		ratio_err, ok2 := evt.Data["raw_ratio_err"].(float64)
+		if ok1 && ok2 && ratio > 0 {
+			return ratio, ratio_err, evt.Run.Number, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+func (w *relgain) ProcessRegion(region *tucs.Region) error {
+	if region.Type != tucs.Readout || len(region.Number(0, 0)) != 4 {
+		// laser data is per ADC
+		return nil
+	}
+
+	events := make([]tucs.Event, 0, len(region.Events()))
+	for _, evt := range region.Events() {
+		if evt.Run.Type == string(tucs.LaserRun) {
+			events = append(events, evt)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Run.Time.Before(events[j].Run.Time)
+	})
+
+	ref, ref_err, refrun, ok := w.reference(region, events)
+	if !ok {
+		if w.verbose {
+			fmt.Printf("laser.RelGain: no reference, skipping: %v\n", region.Hash(0, 0))
+		}
+		return nil
+	}
+
+	for _, evt := range events {
+		ratio, ok1 := evt.Data["raw_ratio"].(float64)
+		ratio_err, ok2 := evt.Data["raw_ratio_err"].(float64)
+		if !ok1 || !ok2 {
+			if w.verbose {
+				fmt.Printf("laser.RelGain: run %d: no laser ratio for: %v\n",
+					evt.Run.Number, region.Hash(0, 0))
+			}
+			continue
+		}
+		rel := ratio / ref
+		evt.Data["gain_var"] = 100 * (rel - 1)
+		evt.Data["gain_var_err"] = 100 * math.Abs(rel) * math.Sqrt(sq(ratio_err/ratio)+sq(ref_err/ref))
+		switch {
+		case refrun != 0 && evt.Run.Number == refrun:
+			// fully correlated with the reference
+			evt.Data["gain_var_err"] = 0.0
+		case ratio == 0:
+			evt.Data["gain_var_err"] = 100 * ratio_err / ref
+		}
+		evt.Data["ref_run"] = refrun
+	}
+	return nil
+}
+
+// check relgain implements the tucs.Worker interface
+var _ tucs.Worker = (*relgain)(nil)
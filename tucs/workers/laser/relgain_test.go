@@ -0,0 +1,60 @@
+package laser
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+func TestRelGain(t *testing.T) {
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	mkevt := func(irun int64, dt time.Duration, ratio float64) tucs.Event {
+		run := tucs.Run{Type: "Las", Number: irun, Time: t0.Add(dt), Data: make(tucs.DataMap)}
+		return tucs.Event{Run: run, Data: tucs.DataMap{"raw_ratio": ratio, "raw_ratio_err": 0.01 * ratio}}
+	}
+	const (
+		hg = "TILECAL_LBA_m01_c00_highgain"
+		lg = "TILECAL_LBA_m01_c00_lowgain"
+	)
+	consts := tucs.NewConstStore()
+	consts.Set(lg, "laser_ref", 4)
+
+	for _, table := range []struct {
+		name   string
+		cfg    RelGainCfg
+		hash   string
+		refrun int64
+		want   []float64 // gain variations of runs 200001, 200002 and 200003
+	}{
+		{"earliest", RelGainCfg{}, hg, 200001, []float64{0, 10, -20}},
+		{"ref-run", RelGainCfg{RefRun: 200002}, hg, 200002, []float64{100 * (2/2.2 - 1), 0, 100 * (1.6/2.2 - 1)}},
+		{"constants", RelGainCfg{Constants: consts}, lg, 0, []float64{-50, -45, -60}},
+		{"no-constant", RelGainCfg{Constants: consts}, hg, 200001, []float64{0, 10, -20}},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			regions := adcs(tucs.TileCal(false, false))
+			region := regions[table.hash]
+			// events out of time order
+			region.AddEvent(mkevt(200003, 2*time.Hour, 1.6))
+			region.AddEvent(mkevt(200001, 0, 2))
+			region.AddEvent(mkevt(200002, time.Hour, 2.2))
+
+			w := RelGain(tucs.Readout, table.cfg)
+			err := w.ProcessRegion(region)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, evt := range region.Events() {
+				want := table.want[evt.Run.Number-200001]
+				if got := evt.Data["gain_var"].(float64); math.Abs(got-want) > 1e-9 {
+					t.Fatalf("run %d: got variation %v, want %v", evt.Run.Number, got, want)
+				}
+				if got := evt.Data["ref_run"].(int64); got != table.refrun {
+					t.Fatalf("run %d: got reference run %d, want %d", evt.Run.Number, got, table.refrun)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package mbias
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+const (
+	// mb_tree is the name of the tree of the minimum-bias ntuples, with one
+	// entry per luminosity block
+	mb_tree = "mbias"
+
+	// nchans is the number of channels of the per-channel arrays of the
+	// minimum-bias ntuples, indexed by [ros-1][module-1][channel]
+	nchans = 4 * 64 * 48
+)
+
+// Series is the time series of the integrator current of a channel, or the
+// average of the channels of a cell, over the luminosity blocks of a run.
+type Series struct {
+	LB      []int       // luminosity block numbers
+	Time    []time.Time // start of the luminosity blocks (zero if unknown)
+	Lumi    []float64   // instantaneous luminosity (10^30 cm^-2 s^-1)
+	Current []float64   // integrator current (nA)
+	Norm    []float64   // integrator current normalised to the luminosity (nA/(10^30 cm^-2 s^-1))
+}
+
+// Len returns the number of luminosity blocks of the series.
+func (s Series) Len() int {
+	return len(s.LB)
+}
+
+// mb_block is the minimum-bias data of a luminosity block
+type mb_block struct {
+	lb      int
+	time    time.Time
+	lumi    float64
+	current []float64 // indexed by ((ros-1)*64+module-1)*48+channel
+}
+
+// readmbias is a tucs.Worker to read minimum-bias integrator currents
+type readmbias struct {
+	tucs.CalibBase
+	minlumi float64
+	data    map[int64][]mb_block
+	verbose bool
+}
+
+type ReadMBiasCfg struct {
+	WorkDir string  // name of the directory holding data
+	MinLumi float64 // minimum instantaneous luminosity of the luminosity blocks used
+	Verbose bool
+}
+
+// ReadMBias returns a worker reading the minimum-bias integrator currents of
+// each channel, per luminosity block, from the tileMBias_<run>.root ntuples of
+// the physics runs selected by the Filter.
+//
+// The currents are normalised to the instantaneous luminosity, and the
+// luminosity blocks with a luminosity not above MinLumi are skipped.
+// The Series of the channel is stored as "mbias" on the events of the channel
+// regions, and the average Series of the channels of its cell as
+// "mbias_cell".
+func ReadMBias(rtype tucs.RegionType, cfg ReadMBiasCfg) tucs.Worker {
+	w := &readmbias{
+		CalibBase: tucs.NewCalibBase(rtype, cfg.WorkDir),
+		minlumi:   cfg.MinLumi,
+		data:      make(map[int64][]mb_block),
+		verbose:   cfg.Verbose,
+	}
+	return w
+}
+
+func (w *readmbias) ProcessStart() error {
+	w.data = make(map[int64][]mb_block)
+	w.ReadRuns("mbias.ReadMBias", tucs.PhysicsRun,
+		func(run tucs.Run) string {
+			return fmt.Sprintf("tileMBias_%v.root", run.Number)
+		},
+		func(run tucs.Run, fname string) error {
+			blocks, err := w.read(fname)
+			if err != nil {
+				return err
+			}
+			w.data[run.Number] = blocks
+			if w.verbose {
+				fmt.Printf("run %d: %d luminosity blocks\n", run.Number, len(blocks))
+			}
+			return nil
+		},
+	)
+	return nil
+}
+
+func (w *readmbias) ProcessStop() error {
+	w.data = make(map[int64][]mb_block)
+	return w.CloseFiles()
+}
+
+// read reads the luminosity blocks of the minimum-bias ntuple fname
+func (w *readmbias) read(fname string) ([]mb_block, error) {
+	var blocks []mb_block
+	err := w.ReadEntries(fname, mb_tree, 0, -1, []string{"lb", "lumi", "time", "current"},
+		func(ientry int64, vals map[string][]float64) error {
+			if len(vals["lb"]) != 1 || len(vals["lumi"]) != 1 || len(vals["current"]) != nchans {
+				return fmt.Errorf("entry %d: missing or invalid lb, lumi and current branches", ientry)
+			}
+			blk := mb_block{
+				lb:      int(vals["lb"][0]),
+				lumi:    vals["lumi"][0],
+				current: vals["current"],
+			}
+			if blk.lumi <= w.minlumi {
+				if w.verbose {
+					fmt.Printf("mbias.ReadMBias: %s: luminosity block %d: luminosity %v, skipping\n",
+						fname, blk.lb, blk.lumi)
+				}
+				return nil
+			}
+			if t := vals["time"]; len(t) == 1 {
+				blk.time = time.Unix(int64(t[0]), 0)
+			}
+			blocks = append(blocks, blk)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// series returns the Series of the channels idx of a run, averaged over the
+// channels.
+func series(blocks []mb_block, idx []int) Series {
+	var s Series
+	for _, blk := range blocks {
+		cur := 0.0
+		for _, i := range idx {
+			cur += blk.current[i]
+		}
+		cur /= float64(len(idx))
+		s.LB = append(s.LB, blk.lb)
+		s.Time = append(s.Time, blk.time)
+		s.Lumi = append(s.Lumi, blk.lumi)
+		s.Current = append(s.Current, cur)
+		s.Norm = append(s.Norm, cur/blk.lumi)
+	}
+	return s
+}
+
+// chan_index returns the index of a channel region in the per-channel arrays.
+func chan_index(nbr []int) int {
+	return ((nbr[0]-1)*64+nbr[1]-1)*48 + nbr[2]
+}
+
+// cell_channels returns the indices of the channels of the cell of channel.
+func cell_channels(channel *tucs.Region) []int {
+	cell := channel.Parent(tucs.Physical, 0)
+	if cell == nil || cell.Type != tucs.Physical {
+		return nil
+	}
+	var idx []int
+	for _, ch := range cell.Children(tucs.Readout) {
+		nbr := ch.Number(0, 0)
+		if ch.Type == tucs.Readout && len(nbr) == 3 {
+			idx = append(idx, chan_index(nbr))
+		}
+	}
+	return idx
+}
+
+func (w *readmbias) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 3 {
+		// integrator currents are per channel
+		return nil
+	}
+	idx := chan_index(nbr)
+	cell := cell_channels(region)
+
+	for _, evt := range region.Events() {
+		blocks, ok := w.data[evt.Run.Number]
+		if evt.Run.Type != string(tucs.PhysicsRun) || !ok {
+			continue
+		}
+		evt.Data["mbias"] = series(blocks, []int{idx})
+		if len(cell) > 0 {
+			evt.Data["mbias_cell"] = series(blocks, cell)
+		}
+	}
+	return nil
+}
+
+// check readmbias implements the tucs.Worker interface
+var _ tucs.Worker = (*readmbias)(nil)
@@ -0,0 +1,120 @@
+package mbias
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+// mb_entry is an entry of the minimum-bias ntuples
+type mb_entry struct {
+	LB      int32
+	Lumi    float32
+	Time    int64
+	Current [nchans]float32
+}
+
+// write_ntuple writes the minimum-bias ntuple fname, with an entry per
+// luminosity block.
+func write_ntuple(t *testing.T, fname string, entries []mb_entry) {
+	t.Helper()
+	f, err := groot.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var e mb_entry
+	tree, err := rtree.NewWriter(f, mb_tree, []rtree.WriteVar{
+		{Name: "lb", Value: &e.LB},
+		{Name: "lumi", Value: &e.Lumi},
+		{Name: "time", Value: &e.Time},
+		{Name: "current", Value: &e.Current},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		e = entry
+		_, err = tree.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadMBias(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	c01 := chan_index([]int{1, 1, 1}) // LBA_m01_c01, in the A1 cell with c04
+	c04 := chan_index([]int{1, 1, 4})
+	var entries []mb_entry
+	for lb := 1; lb <= 3; lb++ {
+		e := mb_entry{LB: int32(lb), Lumi: float32(lb), Time: t0.Add(time.Duration(lb) * time.Minute).Unix()}
+		if lb == 2 {
+			e.Lumi = 0 // no beam
+		}
+		e.Current[c01] = float32(10 * lb)
+		e.Current[c04] = float32(20 * lb)
+		entries = append(entries, e)
+	}
+	write_ntuple(t, filepath.Join(dir, "tileMBias_200006.root"), entries)
+
+	run := tucs.Run{Type: string(tucs.PhysicsRun), Number: 200006, Time: t0, Data: make(tucs.DataMap)}
+	tucs.Runs = tucs.RunList{
+		run,
+		{Type: string(tucs.PhysicsRun), Number: 200008, Time: t0, Data: make(tucs.DataMap)}, // no ntuple
+	}
+
+	w := ReadMBias(tucs.Readout, ReadMBiasCfg{WorkDir: dir})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+	if len(tucs.Runs) != 1 || tucs.Runs[0].Number != run.Number {
+		t.Fatalf("got runs %v, want [%d]", tucs.Runs, run.Number)
+	}
+
+	var channel *tucs.Region
+	tucs.TileCal(false, false).IterRegions(tucs.Readout, func(_ tucs.RegionType, region *tucs.Region) error {
+		if region.Hash(0, 0) == "TILECAL_LBA_m01_c01" {
+			channel = region
+		}
+		return nil
+	})
+	channel.AddEvent(tucs.Event{Run: run, Data: make(tucs.DataMap)})
+	err = w.ProcessRegion(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := channel.Events()[0].Data
+	want := Series{
+		LB:      []int{1, 3},
+		Time:    []time.Time{time.Unix(t0.Add(time.Minute).Unix(), 0), time.Unix(t0.Add(3*time.Minute).Unix(), 0)},
+		Lumi:    []float64{1, 3},
+		Current: []float64{10, 30},
+		Norm:    []float64{10, 10},
+	}
+	if got := data["mbias"].(Series); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got series %+v, want %+v", got, want)
+	}
+	want.Current = []float64{15, 45}
+	want.Norm = []float64{15, 15}
+	if got := data["mbias_cell"].(Series); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got cell series %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package pedestal
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sbinet/go-tucs/tucs"
+)
+
+// ped_tree is the name of the tree of the pedestal ntuples
+const ped_tree = "h3000"
+
+// ped_data holds the per-ADC pedestal and noise of a run
+type ped_data struct {
+	ped tucs.ADCArray // pedestal mean (ADC counts)
+	lfn tucs.ADCArray // low-frequency noise (ADC counts)
+	hfn tucs.ADCArray // high-frequency noise (ADC counts)
+}
+
+// readpedestal is a tucs.Worker to read pedestal and noise data
+type readpedestal struct {
+	tucs.CalibBase
+	refs        *tucs.ConstStore
+	noisy       float64
+	deadhfn     float64
+	maxpedshift float64
+	data        map[int64]*ped_data
+	verbose     bool
+}
+
+type ReadPedestalCfg struct {
+	WorkDir     string           // name of the directory holding data
+	References  *tucs.ConstStore // reference "ped", "lfn" and "hfn" of each ADC
+	NoisyFactor float64          // noise/reference ratio above which an ADC is noisy (default: 2)
+	DeadHFN     float64          // high-frequency noise below which an ADC is dead (default: 0.1)
+	MaxPedShift float64          // maximum pedestal shift from the reference (default: 10)
+	Verbose     bool
+}
+
+// ReadPedestal returns a worker reading the pedestal, low-frequency noise and
+// high-frequency noise of each ADC from the pedestal ntuples of the runs
+// selected by the Filter, and storing them as "ped", "lfn" and "hfn" on the
+// events of the gain regions.
+//
+// When References holds reference values for the ADC, they are stored as
+// "ped_ref", "lfn_ref" and "hfn_ref", along with the pedestal shift
+// ("ped_shift") and the noise ratios to the references ("lfn_ratio" and
+// "hfn_ratio"). The ADCs are flagged with "dead" (no noise or no pedestal),
+// "noisy" (a noise ratio above NoisyFactor) and "bad_ped" (pedestal shift
+// above MaxPedShift).
+func ReadPedestal(rtype tucs.RegionType, cfg ReadPedestalCfg) tucs.Worker {
+	w := &readpedestal{
+		CalibBase:   tucs.NewCalibBase(rtype, cfg.WorkDir),
+		refs:        cfg.References,
+		noisy:       cfg.NoisyFactor,
+		deadhfn:     cfg.DeadHFN,
+		maxpedshift: cfg.MaxPedShift,
+		data:        make(map[int64]*ped_data),
+		verbose:     cfg.Verbose,
+	}
+	if w.refs == nil {
+		w.refs = tucs.NewConstStore()
+	}
+	if w.noisy <= 0 {
+		w.noisy = 2
+	}
+	if w.deadhfn <= 0 {
+		w.deadhfn = 0.1
+	}
+	if w.maxpedshift <= 0 {
+		w.maxpedshift = 10
+	}
+	return w
+}
+
+func (w *readpedestal) ProcessStart() error {
+	w.data = make(map[int64]*ped_data)
+	w.ReadRuns("pedestal.ReadPedestal", tucs.PedestalRun,
+		func(run tucs.Run) string {
+			return fmt.Sprintf("tileCalibPed_%v_Ped.0.root", run.Number)
+		},
+		func(run tucs.Run, fname string) error {
+			data, err := w.read(fname)
+			if err != nil {
+				return err
+			}
+			w.data[run.Number] = data
+			return nil
+		},
+	)
+	return nil
+}
+
+func (w *readpedestal) ProcessStop() error {
+	return w.CloseFiles()
+}
+
+// read reads the per-ADC pedestal and noise of the pedestal ntuple fname
+func (w *readpedestal) read(fname string) (*ped_data, error) {
+	vals, err := w.ReadEntry(fname, ped_tree, 0, "ped", "lfn", "hfn")
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ped_data{}
+	for name, dst := range map[string]*tucs.ADCArray{
+		"ped": &data.ped,
+		"lfn": &data.lfn,
+		"hfn": &data.hfn,
+	} {
+		err = dst.Set(vals[name])
+		if err != nil {
+			return nil, fmt.Errorf("branch %q of %q holds %w", name, fname, err)
+		}
+	}
+	return data, nil
+}
+
+func (w *readpedestal) ProcessRegion(region *tucs.Region) error {
+	nbr := region.Number(0, 0)
+	if region.Type != tucs.Readout || len(nbr) != 4 {
+		// pedestals are per ADC
+		return nil
+	}
+	hash := region.Hash(0, 0)
+
+	for _, evt := range region.Events() {
+		data, ok := w.data[evt.Run.Number]
+		if evt.Run.Type != string(tucs.PedestalRun) || !ok {
+			continue
+		}
+		ped := data.ped.At(nbr)
+		lfn := data.lfn.At(nbr)
+		hfn := data.hfn.At(nbr)
+		evt.Data["ped"] = ped
+		evt.Data["lfn"] = lfn
+		evt.Data["hfn"] = hfn
+
+		dead := ped <= 0 || hfn < w.deadhfn
+		noisy := false
+		bad_ped := false
+		if ref, ok := w.refs.Get(hash, "ped"); ok {
+			evt.Data["ped_ref"] = ref
+			evt.Data["ped_shift"] = ped - ref
+			bad_ped = math.Abs(ped-ref) > w.maxpedshift
+		}
+		for _, v := range []struct {
+			name string
+			val  float64
+		}{{"lfn", lfn}, {"hfn", hfn}} {
+			ref, ok := w.refs.Get(hash, v.name)
+			if !ok || ref <= 0 {
+				continue
+			}
+			evt.Data[v.name+"_ref"] = ref
+			evt.Data[v.name+"_ratio"] = v.val / ref
+			if v.val/ref > w.noisy {
+				noisy = true
+			}
+		}
+		evt.Data["dead"] = dead
+		evt.Data["noisy"] = noisy && !dead
+		evt.Data["bad_ped"] = bad_ped
+
+		if w.verbose && (dead || noisy || bad_ped) {
+			fmt.Printf("run %d: ped=%.2f lfn=%.3f hfn=%.3f (dead=%v, noisy=%v, bad_ped=%v) for: %v\n",
+				evt.Run.Number, ped, lfn, hfn, dead, noisy && !dead, bad_ped, hash)
+		}
+	}
+	return nil
+}
+
+// check readpedestal implements the tucs.Worker interface
+var _ tucs.Worker = (*readpedestal)(nil)
@@ -0,0 +1,130 @@
+package pedestal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sbinet/go-tucs/tucs"
+	"go-hep.org/x/hep/groot"
+	"go-hep.org/x/hep/groot/rtree"
+)
+
+// adc_array holds a value per ADC, as stored in the pedestal ntuples
+type adc_array [4][64][48][2]float32
+
+// write_ntuple writes the pedestal ntuple fname, whose single entry holds the
+// values pointed at by vars.
+func write_ntuple(t *testing.T, fname string, vars []rtree.WriteVar) {
+	t.Helper()
+	f, err := groot.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tree, err := rtree.NewWriter(f, ped_tree, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tree.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadPedestal(t *testing.T) {
+	dir := t.TempDir()
+	var ped, lfn, hfn adc_array
+	for ros := range ped {
+		for mod := range ped[ros] {
+			for ch := range ped[ros][mod] {
+				ped[ros][mod][ch] = [2]float32{50, 50}
+				lfn[ros][mod][ch] = [2]float32{1, 1}
+				hfn[ros][mod][ch] = [2]float32{1.5, 1.5}
+			}
+		}
+	}
+	hfn[0][0][1][0] = 4    // LBA_m01_c01_lowgain: noisy
+	hfn[0][0][1][1] = 0.05 // LBA_m01_c01_highgain: dead
+	ped[0][0][2][0] = 70   // LBA_m01_c02_lowgain: bad pedestal
+	write_ntuple(t, filepath.Join(dir, "tileCalibPed_200009_Ped.0.root"), []rtree.WriteVar{
+		{Name: "ped", Value: &ped},
+		{Name: "lfn", Value: &lfn},
+		{Name: "hfn", Value: &hfn},
+	})
+
+	refs := tucs.NewConstStore()
+	for _, hash := range []string{
+		"TILECAL_LBA_m01_c00_lowgain",
+		"TILECAL_LBA_m01_c01_lowgain",
+		"TILECAL_LBA_m01_c01_highgain",
+		"TILECAL_LBA_m01_c02_lowgain",
+	} {
+		refs.Set(hash, "ped", 50)
+		refs.Set(hash, "lfn", 1)
+		refs.Set(hash, "hfn", 1.5)
+	}
+
+	t0 := time.Date(2012, time.May, 1, 12, 0, 0, 0, time.UTC)
+	run := tucs.Run{Type: string(tucs.PedestalRun), Number: 200009, Time: t0, Data: make(tucs.DataMap)}
+	tucs.Runs = tucs.RunList{run}
+
+	w := ReadPedestal(tucs.Readout, ReadPedestalCfg{WorkDir: dir, References: refs})
+	err := w.ProcessStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.ProcessStop()
+
+	regions := make(map[string]*tucs.Region)
+	tucs.TileCal(false, false).IterRegions(tucs.Readout, func(_ tucs.RegionType, region *tucs.Region) error {
+		if len(region.Number(0, 0)) == 4 {
+			regions[region.Hash(0, 0)] = region
+		}
+		return nil
+	})
+	for _, table := range []struct {
+		hash    string
+		hfn     float64
+		refs    bool
+		dead    bool
+		noisy   bool
+		bad_ped bool
+	}{
+		{"TILECAL_LBA_m01_c00_lowgain", 1.5, true, false, false, false},
+		{"TILECAL_LBA_m01_c00_highgain", 1.5, false, false, false, false},
+		{"TILECAL_LBA_m01_c01_lowgain", 4, true, false, true, false},
+		{"TILECAL_LBA_m01_c01_highgain", 0.05, true, true, false, false},
+		{"TILECAL_LBA_m01_c02_lowgain", 1.5, true, false, false, true},
+	} {
+		region := regions[table.hash]
+		region.AddEvent(tucs.Event{Run: run, Data: make(tucs.DataMap)})
+		err = w.ProcessRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := region.Events()[0].Data
+		if got := data["hfn"].(float64); float32(got) != float32(table.hfn) {
+			t.Fatalf("%s: got hfn %v, want %v", table.hash, got, table.hfn)
+		}
+		if _, ok := data["hfn_ratio"]; ok != table.refs {
+			t.Fatalf("%s: got references=%v, want %v", table.hash, ok, table.refs)
+		}
+		for _, flag := range []struct {
+			name string
+			want bool
+		}{{"dead", table.dead}, {"noisy", table.noisy}, {"bad_ped", table.bad_ped}} {
+			if got := data[flag.name].(bool); got != flag.want {
+				t.Fatalf("%s: got %s=%v, want %v", table.hash, flag.name, got, flag.want)
+			}
+		}
+	}
+}